@@ -0,0 +1,133 @@
+package geecache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 面向客户端的REST API，与节点间的protobuf协议使用不同的路径:
+//
+//	GET    /_geecache_api/<group>/<key>          获取原始value
+//	HEAD   /_geecache_api/<group>/<key>          判断key是否存在
+//	PUT    /_geecache_api/<group>/<key>?ttl=30s  写入请求体作为value
+//	DELETE /_geecache_api/<group>/<key>          在所有节点上删除
+//
+// 出错时返回JSON格式的apiError
+//
+// API不在节点间通信的handler上，需要通过APIHandler单独挂载，
+// PUT与DELETE会写入数据源并通知其他节点，应只对可信的客户端开放
+
+// apiError API返回的错误
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Code: code, Message: message})
+}
+
+// 根据Set与Invalidate的错误选择状态码
+func writeSetError(w http.ResponseWriter, err error) {
+	var be *backendError
+	var pe *peerError
+	switch {
+	case errors.As(err, &be):
+		writeAPIError(w, http.StatusBadGateway, "backend_error", err.Error())
+	case errors.As(err, &pe):
+		writeAPIError(w, http.StatusBadGateway, "peer_error", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
+// APIHandler 返回REST API的handler，处理APIPath下的请求，例如
+//
+//	mux.Handle("/_geecache_api/", pool.APIHandler())
+func (p *HTTPPool) APIHandler() http.Handler {
+	return http.HandlerFunc(p.serveAPI)
+}
+
+func (p *HTTPPool) serveAPI(w http.ResponseWriter, r *http.Request) {
+	//按转义后的路径切分，key中可以包含"/"(%2F)
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.EscapedPath(), p.apiPath), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "path should be "+p.apiPath+"<group>/<key>")
+		return
+	}
+	groupName, err := url.PathUnescape(parts[0])
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	key, err := url.PathUnescape(parts[1])
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	group := GetGroup(groupName)
+	if group == nil {
+		writeAPIError(w, http.StatusNotFound, "group_not_found", "no such group: "+groupName)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		view, err := group.GetContext(r.Context(), key)
+		if errors.Is(err, ErrNotFound) {
+			writeAPIError(w, http.StatusNotFound, "key_not_found", "no such key: "+key)
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "load_failed", err.Error())
+			return
+		}
+		value, err := view.Bytes()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "corrupt_value", err.Error())
+			return
+		}
+		if !view.Expire().IsZero() {
+			w.Header().Set("Expires", view.Expire().UTC().Format(http.TimeFormat))
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if r.Method == http.MethodGet {
+			w.Write(value)
+		}
+	case http.MethodPut:
+		var ttl time.Duration
+		if s := r.URL.Query().Get("ttl"); s != "" {
+			if ttl, err = time.ParseDuration(s); err != nil {
+				writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid ttl: "+err.Error())
+				return
+			}
+		}
+		value, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		if err = group.Set(key, value, ttl); err != nil {
+			writeSetError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := group.Invalidate(key); err != nil {
+			writeSetError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed")
+	}
+}
@@ -0,0 +1,116 @@
+package geecache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	NewGroup("api", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			if key == "broken" {
+				return nil, fmt.Errorf("db is down")
+			}
+			return nil, ErrNotFound
+		}))
+	pool := NewHTTPPool("http://localhost:8001")
+	mux := http.NewServeMux()
+	mux.Handle(defaultAPIPath, pool.APIHandler())
+	mux.Handle("/", pool)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(method, path, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := ioutil.ReadAll(res.Body)
+		return res, string(b)
+	}
+	expectError := func(method, path string, status int, code string) {
+		res, body := do(method, path, "")
+		var e apiError
+		if res.StatusCode != status {
+			t.Fatalf("%s %s: expect %d, got %d", method, path, status, res.StatusCode)
+		}
+		if method != http.MethodHead && (json.Unmarshal([]byte(body), &e) != nil || e.Code != code) {
+			t.Fatalf("%s %s: expect json error %s, got %s", method, path, code, body)
+		}
+	}
+
+	if res, body := do("GET", "/_geecache_api/api/Tom", ""); res.StatusCode != 200 || body != "630" ||
+		res.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("GET Tom returned %d %q", res.StatusCode, body)
+	}
+	if res, _ := do("HEAD", "/_geecache_api/api/Tom", ""); res.StatusCode != 200 {
+		t.Fatalf("HEAD Tom returned %d", res.StatusCode)
+	}
+	expectError("HEAD", "/_geecache_api/api/unknown", 404, "")
+	expectError("GET", "/_geecache_api/api/unknown", 404, "key_not_found")
+	expectError("GET", "/_geecache_api/nogroup/Tom", 404, "group_not_found")
+	expectError("GET", "/_geecache_api/api/broken", 500, "load_failed")
+	expectError("GET", "/_geecache_api/api", 400, "bad_request")
+	expectError("POST", "/_geecache_api/api/Tom", 405, "method_not_allowed")
+	expectError("PUT", "/_geecache_api/api/Tom?ttl=abc", 400, "bad_request")
+
+	if res, _ := do("PUT", "/_geecache_api/api/a%2Fb?ttl=1m", "new"); res.StatusCode != 204 {
+		t.Fatalf("PUT returned %d", res.StatusCode)
+	}
+	if res, body := do("GET", "/_geecache_api/api/a%2Fb", ""); body != "new" || res.Header.Get("Expires") == "" {
+		t.Fatalf("GET after PUT returned %q", body)
+	}
+	if res, _ := do("DELETE", "/_geecache_api/api/a%2Fb", ""); res.StatusCode != 204 {
+		t.Fatalf("DELETE returned %d", res.StatusCode)
+	}
+	expectError("GET", "/_geecache_api/api/a%2Fb", 404, "key_not_found")
+
+	//未知路径不再panic
+	if res, _ := do("GET", "/unknown", ""); res.StatusCode != 404 {
+		t.Fatalf("unexpected path returned %d", res.StatusCode)
+	}
+
+	//节点间的handler不提供API
+	peerSrv := httptest.NewServer(pool)
+	defer peerSrv.Close()
+	res, err := http.Get(peerSrv.URL + "/_geecache_api/api/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Fatalf("peer handler should not serve the API, got %d", res.StatusCode)
+	}
+}
+
+func TestAPISetError(t *testing.T) {
+	NewGroup("apiset", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return nil, ErrNotFound }),
+		WithWriteThrough(SetterFunc(func(key string, value []byte) error {
+			return fmt.Errorf("db is read-only")
+		})))
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001").APIHandler())
+	defer srv.Close()
+
+	//数据源写入失败不是节点错误
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/_geecache_api/apiset/k", strings.NewReader("v"))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var e apiError
+	if json.NewDecoder(res.Body).Decode(&e); res.StatusCode != 502 || e.Code != "backend_error" {
+		t.Fatalf("expect 502 backend_error, got %d %s", res.StatusCode, e.Code)
+	}
+}
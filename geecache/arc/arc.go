@@ -0,0 +1,277 @@
+package arc
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value 与lru.Value相同，便于各淘汰策略互换
+type Value = lru.Value
+
+// 自适应替换缓存(ARC)淘汰策略，按字节计算容量
+// t1: 只访问过一次的条目  t2: 访问过多次的条目
+// b1/b2: 分别从t1/t2淘汰的key(幽灵条目，不保存值)
+// 根据幽灵条目的命中情况，自适应调整t1的目标大小p
+type Cache struct {
+	maxBytes  int64
+	p         int64 //t1的目标大小
+	t1, t2    *list.List
+	b1, b2    *list.List
+	t1Bytes   int64
+	t2Bytes   int64
+	b1Bytes   int64
+	b2Bytes   int64
+	items     map[string]*list.Element //常驻条目
+	ghosts    map[string]*list.Element //幽灵条目
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key      string
+	value    Value
+	expire   time.Time
+	frequent bool //是否位于t2
+}
+
+type ghost struct {
+	key      string
+	size     int64
+	frequent bool //是否位于b2
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+// new a instance
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        list.New(),
+		t2:        list.New(),
+		b1:        list.New(),
+		b2:        list.New(),
+		items:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 命中t1的条目会被提升到t2
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.items[key]
+	if !ok {
+		return
+	}
+	kv := ele.Value.(*entry)
+	if kv.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.unlink(ele)
+	c.pushFrequent(kv)
+	return kv.value, true
+}
+
+// add or modify
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	kv := &entry{key: key, value: value, expire: expire}
+	//超过总容量的条目放不下，与LRU一样直接淘汰，不影响已有的条目
+	if c.maxBytes != 0 && kv.size() > c.maxBytes {
+		c.reject(kv)
+		return
+	}
+	//已存在，更新后放入t2
+	if ele, ok := c.items[key]; ok {
+		c.unlink(ele)
+		delete(c.items, key)
+		c.makeRoom(kv.size(), false)
+		c.pushFrequent(kv)
+		return
+	}
+	//命中幽灵条目，调整p后放入t2
+	if ele, ok := c.ghosts[key]; ok {
+		g := ele.Value.(*ghost)
+		c.adapt(g, kv.size())
+		c.removeGhost(ele)
+		c.makeRoom(kv.size(), g.frequent)
+		c.pushFrequent(kv)
+		c.trimGhosts()
+		return
+	}
+	c.makeRoom(kv.size(), false)
+	c.items[key] = c.t1.PushFront(kv)
+	c.t1Bytes += kv.size()
+	c.trimGhosts()
+}
+
+// 淘汰一个条目
+func (c *Cache) RemoveOldest() {
+	if c.t1.Len()+c.t2.Len() == 0 {
+		return
+	}
+	c.replace(false)
+	c.trimGhosts()
+}
+
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.items[key]; ok {
+		c.removeElement(ele)
+	}
+	if ele, ok := c.ghosts[key]; ok {
+		c.removeGhost(ele)
+	}
+}
+
+func (c *Cache) RemoveExpired() {
+	now := time.Now()
+	for _, ele := range c.items {
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.items)
+}
+
+// 当前已使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.t1Bytes + c.t2Bytes
+}
+
+// 依次遍历t1、t2中的条目(各自从旧到新)，f返回false时停止
+func (c *Cache) Range(f func(key string, value Value, expire time.Time) bool) {
+	if rangeList(c.t1, f) {
+		rangeList(c.t2, f)
+	}
+}
+
+func rangeList(l *list.List, f func(key string, value Value, expire time.Time) bool) bool {
+	for ele := l.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !f(kv.key, kv.value, kv.expire) {
+			return false
+		}
+	}
+	return true
+}
+
+// 幽灵条目命中说明对应的链表太小了
+// 命中b1则增大p，命中b2则减小p
+func (c *Cache) adapt(g *ghost, size int64) {
+	delta := size
+	if !g.frequent {
+		if c.b1Bytes > 0 && c.b2Bytes > c.b1Bytes {
+			delta *= c.b2Bytes / c.b1Bytes
+		}
+		c.p += delta
+		if c.maxBytes != 0 && c.p > c.maxBytes {
+			c.p = c.maxBytes
+		}
+	} else {
+		if c.b2Bytes > 0 && c.b1Bytes > c.b2Bytes {
+			delta *= c.b1Bytes / c.b2Bytes
+		}
+		c.p -= delta
+		if c.p < 0 {
+			c.p = 0
+		}
+	}
+}
+
+// 为size字节的新条目腾出空间
+func (c *Cache) makeRoom(size int64, b2Hit bool) {
+	for c.maxBytes != 0 && c.t1.Len()+c.t2.Len() > 0 && c.t1Bytes+c.t2Bytes+size > c.maxBytes {
+		c.replace(b2Hit)
+	}
+}
+
+// t1超过目标大小时淘汰t1，否则淘汰t2，被淘汰的key进入对应的幽灵链表
+func (c *Cache) replace(b2Hit bool) {
+	var ele *list.Element
+	if c.t1.Len() > 0 && (c.t1Bytes > c.p || (c.t1Bytes == c.p && b2Hit) || c.t2.Len() == 0) {
+		ele = c.t1.Back()
+	} else {
+		ele = c.t2.Back()
+	}
+	kv := ele.Value.(*entry)
+	c.removeElement(ele)
+	g := &ghost{key: kv.key, size: kv.size(), frequent: kv.frequent}
+	if g.frequent {
+		c.ghosts[g.key] = c.b2.PushFront(g)
+		c.b2Bytes += g.size
+	} else {
+		c.ghosts[g.key] = c.b1.PushFront(g)
+		c.b1Bytes += g.size
+	}
+}
+
+// 保证 t1+b1 <= maxBytes，且总大小 <= 2*maxBytes
+func (c *Cache) trimGhosts() {
+	for c.b1.Len() > 0 && (c.maxBytes == 0 || c.t1Bytes+c.b1Bytes > c.maxBytes) {
+		c.removeGhost(c.b1.Back())
+	}
+	for c.b2.Len() > 0 && (c.maxBytes == 0 || c.t1Bytes+c.t2Bytes+c.b1Bytes+c.b2Bytes > 2*c.maxBytes) {
+		c.removeGhost(c.b2.Back())
+	}
+}
+
+// 丢弃放不下的条目，key原有的值与幽灵条目一并删除
+func (c *Cache) reject(kv *entry) {
+	if ele, ok := c.items[kv.key]; ok {
+		c.unlink(ele)
+		delete(c.items, kv.key)
+	}
+	if ele, ok := c.ghosts[kv.key]; ok {
+		c.removeGhost(ele)
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) pushFrequent(kv *entry) {
+	kv.frequent = true
+	c.items[kv.key] = c.t2.PushFront(kv)
+	c.t2Bytes += kv.size()
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.unlink(ele)
+	delete(c.items, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// 从t1或t2中摘除，不触发回调
+func (c *Cache) unlink(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.frequent {
+		c.t2.Remove(ele)
+		c.t2Bytes -= kv.size()
+	} else {
+		c.t1.Remove(ele)
+		c.t1Bytes -= kv.size()
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	g := ele.Value.(*ghost)
+	if g.frequent {
+		c.b2.Remove(ele)
+		c.b2Bytes -= g.size
+	} else {
+		c.b1.Remove(ele)
+		c.b1Bytes -= g.size
+	}
+	delete(c.ghosts, g.key)
+}
@@ -0,0 +1,172 @@
+package geecache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 节点间认证，保护ServeHTTP处理的所有请求(节点间协议与统计数据)，两种方式可以同时使用:
+//
+//   - 双向TLS: HTTPPoolOptions.TLSConfig，请求方出示证书，服务端只接受CA签发的客户端证书
+//   - 共享密钥: HTTPPoolOptions.Secret，请求方用HMAC-SHA256对请求签名，服务端校验签名与时间戳
+//
+// APIHandler不做校验，应挂载在单独的端口上，或由外层handler保护。
+// 每个签名的请求带有随机的nonce，服务端在签名有效期内记住见过的nonce，拒绝重放的请求
+const (
+	headerTimestamp = "X-Geecache-Timestamp"
+	headerNonce     = "X-Geecache-Nonce"
+	headerSignature = "X-Geecache-Signature"
+	maxClockSkew    = 5 * time.Minute //签名的有效期，也是允许的最大时钟偏差
+
+	defaultMaxBodyBytes = 64 << 20 //默认的请求体上限，校验签名前最多读取这么多
+)
+
+var (
+	errUnauthorized = errors.New("geecache: unauthorized peer")
+	errBodyTooLarge = errors.New("geecache: request body too large")
+)
+
+// 读取证书与CA，创建双向TLS配置
+// 同一个配置既可以作为http.Server.TLSConfig，也可以作为HTTPPoolOptions.TLSConfig
+func NewMutualTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("geecache: no certificates found in %s", caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// 签名内容: 方法、请求URI、时间戳、nonce与请求体的哈希
+func sign(secret []byte, method, uri, ts, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%x", method, uri, ts, nonce, sum)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 请求方为请求添加签名
+func signRequest(req *http.Request, secret []byte) error {
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if body, err = ioutil.ReadAll(rc); err != nil {
+			return err
+		}
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := hex.EncodeToString(b[:])
+	req.Header.Set(headerTimestamp, ts)
+	req.Header.Set(headerNonce, nonce)
+	req.Header.Set(headerSignature, sign(secret, req.Method, req.URL.RequestURI(), ts, nonce, body))
+	return nil
+}
+
+// 签名有效期内见过的nonce，用于拒绝重放的请求
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[string]int64 //nonce -> 过期时间(Unix秒)，过期后签名本身已失效
+	pruneN int              //数量达到该值时清理过期的nonce
+}
+
+// 记录nonce，已经见过时返回false
+func (c *nonceCache) add(nonce string, expire int64, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]int64)
+	}
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	if len(c.seen) >= c.pruneN {
+		for n, exp := range c.seen {
+			if exp < now.Unix() {
+				delete(c.seen, n)
+			}
+		}
+		c.pruneN = 2*len(c.seen) + 1024
+	}
+	c.seen[nonce] = expire
+	return true
+}
+
+// 校验其他节点的请求，配置了TLSConfig时要求出示经过验证的客户端证书，
+// 配置了Secret时要求签名正确、没有过期且不是重放的请求
+// 请求体超过MaxBodyBytes时，不读取剩余部分，直接返回errBodyTooLarge
+func (p *HTTPPool) authenticate(w http.ResponseWriter, r *http.Request) error {
+	if p.opts.TLSConfig != nil && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return errUnauthorized
+	}
+	if len(p.opts.Secret) == 0 {
+		return nil
+	}
+	ts := r.Header.Get(headerTimestamp)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errUnauthorized
+	}
+	now := time.Now()
+	if d := now.Sub(time.Unix(sec, 0)); d > maxClockSkew || d < -maxClockSkew {
+		return errUnauthorized
+	}
+	nonce := r.Header.Get(headerNonce)
+	if nonce == "" {
+		return errUnauthorized
+	}
+	//读取请求体计算签名，再放回去供后续处理；签名校验前限制读取的大小
+	if r.ContentLength > p.opts.MaxBodyBytes {
+		return errBodyTooLarge
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, p.opts.MaxBodyBytes))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return errBodyTooLarge
+		}
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	want := sign(p.opts.Secret, r.Method, r.RequestURI, ts, nonce, body)
+	if !hmac.Equal([]byte(want), []byte(r.Header.Get(headerSignature))) {
+		return errUnauthorized
+	}
+	//签名正确后才记录nonce，避免伪造的请求占满缓存
+	if !p.nonces.add(nonce, sec+int64(maxClockSkew/time.Second), now) {
+		return errUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package geecache
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	pb "geecache/geecachepb"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试用的证书，parent为nil时生成自签名的CA
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// 写入PEM文件，返回证书与私钥的路径
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+".key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func (c *testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	NewGroup("mtls", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "peer", ca).write(t, dir, "peer")
+	config, err := NewMutualTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewHTTPPoolOpts("https://127.0.0.1", &HTTPPoolOptions{TLSConfig: config, FailureBackoff: -1})
+	srv := httptest.NewUnstartedServer(p)
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	req := &pb.Request{Group: "mtls", Key: "Tom"}
+	res := &pb.Response{}
+	if err = p.newGetter(srv.URL).Get(context.Background(), req, res); err != nil || string(res.Value) != "Tom" {
+		t.Fatalf("peer with a valid certificate should be served, got %v", err)
+	}
+
+	//不出示证书，或证书不是同一个CA签发的，握手失败
+	rogue := newTestCert(t, "rogue", newTestCert(t, "rogue-ca", nil))
+	for name, certs := range map[string][]tls.Certificate{
+		"no certificate":    nil,
+		"rogue certificate": {rogue.tlsCert()},
+	} {
+		other := NewHTTPPoolOpts("https://127.0.0.1", &HTTPPoolOptions{
+			TLSConfig:      &tls.Config{RootCAs: config.RootCAs, Certificates: certs},
+			FailureBackoff: -1,
+		})
+		if err = other.newGetter(srv.URL).Get(context.Background(), req, &pb.Response{}); err == nil {
+			t.Fatalf("peer with %s should be rejected", name)
+		}
+	}
+
+	//服务端未要求客户端证书时，ServeHTTP也会拒绝
+	plain := httptest.NewTLSServer(p)
+	defer plain.Close()
+	client := plain.Client()
+	resp, err := client.Get(plain.URL + defaultBasePath + "mtls/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect 401 without a verified client certificate, got %v", resp.Status)
+	}
+}
+
+func TestSharedSecret(t *testing.T) {
+	NewGroup("secret", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	opts := &HTTPPoolOptions{Secret: []byte("s3cret"), FailureBackoff: -1}
+	p := NewHTTPPoolOpts("http://localhost:8001", opts)
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	req := &pb.Request{Group: "secret", Key: "Tom"}
+	res := &pb.Response{}
+	if err := p.newGetter(srv.URL).Get(context.Background(), req, res); err != nil || string(res.Value) != "Tom" {
+		t.Fatalf("signed request should be served, got %v", err)
+	}
+	//带请求体的请求也要签名
+	multi := &pb.MultiResponse{}
+	if err := p.newGetter(srv.URL).GetMulti(context.Background(), &pb.MultiRequest{Group: "secret", Keys: []string{"Tom"}}, multi); err != nil || len(multi.Items) != 1 {
+		t.Fatalf("signed multi request should be served, got %v", err)
+	}
+
+	for _, secret := range []string{"", "wrong"} {
+		other := NewHTTPPoolOpts("http://localhost:8002", &HTTPPoolOptions{Secret: []byte(secret), FailureBackoff: -1})
+		if err := other.newGetter(srv.URL).Get(context.Background(), req, &pb.Response{}); err == nil {
+			t.Fatalf("request signed with %q should be rejected", secret)
+		}
+	}
+
+	//统计数据也需要签名
+	resp, err := http.Get(srv.URL + defaultStatsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unsigned stats request should be rejected, got %v", resp.Status)
+	}
+
+	//过期的签名被拒绝
+	u := srv.URL + defaultBasePath + "secret/Tom"
+	r, _ := http.NewRequest(http.MethodGet, u, nil)
+	ts := strconv.FormatInt(time.Now().Add(-2*maxClockSkew).Unix(), 10)
+	r.Header.Set(headerTimestamp, ts)
+	r.Header.Set(headerNonce, "n1")
+	r.Header.Set(headerSignature, sign(opts.Secret, http.MethodGet, r.URL.RequestURI(), ts, "n1", nil))
+	resp, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expired signature should be rejected, got %v", resp.Status)
+	}
+
+	//重放同一个签名的请求被拒绝
+	r, _ = http.NewRequest(http.MethodDelete, u, nil)
+	if err = signRequest(r, opts.Secret); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		resp, err = http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("request %d: expect %d, got %v", i, want, resp.Status)
+		}
+	}
+}
+
+func TestSecretBodyLimit(t *testing.T) {
+	NewGroup("bodylimit", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	opts := &HTTPPoolOptions{Secret: []byte("s3cret"), MaxBodyBytes: 1 << 10, FailureBackoff: -1}
+	srv := httptest.NewServer(NewHTTPPoolOpts("http://localhost:8001", opts))
+	defer srv.Close()
+
+	//签名校验前就拒绝过大的请求体，包括不带Content-Length的请求
+	for _, length := range []int64{2 << 10, -1} {
+		r, _ := http.NewRequest(http.MethodPut, srv.URL+defaultBasePath+"bodylimit/k", strings.NewReader(strings.Repeat("v", 2<<10)))
+		r.ContentLength = length
+		r.Header.Set(headerTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+		r.Header.Set(headerNonce, "n")
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("oversized body should be rejected, got %v", resp.Status)
+		}
+	}
+}
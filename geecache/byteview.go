@@ -1,18 +1,53 @@
 package geecache
 
+import (
+	"log"
+	"time"
+)
 
 //只读的，只能返回b的拷贝
 type ByteView struct {
 	b []byte
+	e time.Time //过期时间，零值表示永不过期
+	c Codec     //b的压缩方式，为nil时未压缩
 }
 
+// 返回保存的字节数，压缩后为压缩后的大小
 func (v ByteView) Len() int {
 	return len(v.b)
 }
 
-// 返回数据的拷贝值（只读）
+// 返回过期时间
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// 在now时刻是否已经过期
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && now.After(v.e)
+}
+
+// 返回数据的拷贝值（只读），压缩的数据在这里解压
+// 解压失败(数据已损坏)时返回nil，无法区分空值，需要区分时使用Bytes
 func (v ByteView) Byteslice() []byte {
-	return cloneBytes(v.b)
+	b, err := v.Bytes()
+	if err != nil {
+		log.Println("[GeeCache] Failed to decode value", err)
+		return nil
+	}
+	return b
+}
+
+// 同Byteslice，解压失败时返回错误
+func (v ByteView) Bytes() ([]byte, error) {
+	if v.c == nil {
+		return cloneBytes(v.b), nil
+	}
+	b, err := v.c.Decode(v.b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
 func cloneBytes(b []byte) []byte {
@@ -21,6 +56,10 @@ func cloneBytes(b []byte) []byte {
 	return c
 }
 
+// 解压失败时返回空字符串，同Byteslice
 func (v ByteView) String() string {
-	return string(v.b)
+	if v.c == nil {
+		return string(v.b)
+	}
+	return string(v.Byteslice())
 }
@@ -2,32 +2,352 @@ package geecache
 
 import (
 	"geecache/lru"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const (
+	defaultShards = 16      //mainCache默认分片数
+	minShardBytes = 4 << 10 //每个分片至少分到的容量，容量太小时减少分片数
+)
+
+// cache 按key的哈希值分为多个分片，每个分片有独立的锁和容量，
+// 减少高并发下对同一把锁的争用
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
-	cacheBytes int64
+	nbytes        int64      //所有分片已使用的内存，原子读写，供内存仲裁使用
+	newPolicy     PolicyFunc //为nil时使用LRU
+	cacheBytes    int64
+	nshards       int           //分片数，为0时不分片
+	sweepInterval time.Duration //后台清理过期条目的周期
+	grace         time.Duration //条目过期后继续保留的时间，期间可作为旧值返回
+	initOnce      sync.Once
+	sweepOnce     sync.Once
+	stopOnce      sync.Once
+	stop          chan struct{} //关闭后停止后台清理
+	shards        []*cacheShard
+	tracked       bool //计入arbiter.used，只有group中的cache参与全局内存上限
+
+	spill func(key string, value ByteView) //不为nil时接收因容量被淘汰的未过期条目
+}
+
+type cacheShard struct {
+	mu      sync.Mutex
+	policy  Policy
+	nget    int64
+	nhit    int64
+	nevict  int64 //被淘汰、删除或过期的条目数
+	remove  bool  //正在主动删除，被删除的条目不交给spill
+	tracked bool  //计入arbiter.used，所属group被替换后为false
+
+	//写磁盘可能很慢(例如压缩日志)，淘汰的条目先放在spilled中，释放mu后再交给spill
+	spillMu sync.Mutex   //交给spill期间持有，保证删除磁盘中的key时没有正在写入的旧值
+	spilled []spillEntry //等待交给spill的条目，由mu保护
+}
+
+type spillEntry struct {
+	key   string
+	value ByteView
+}
+
+// lazy init，在第一次使用时按配置创建分片
+func (c *cache) init() {
+	c.initOnce.Do(func() {
+		if c.newPolicy == nil {
+			c.newPolicy = LRU
+		}
+		n := c.nshards
+		if c.cacheBytes > 0 && int64(n)*minShardBytes > c.cacheBytes {
+			n = int(c.cacheBytes / minShardBytes)
+		}
+		if n < 1 {
+			n = 1
+		}
+		c.stop = make(chan struct{})
+		c.shards = make([]*cacheShard, n)
+		for i := range c.shards {
+			s := &cacheShard{tracked: c.tracked}
+			//容量为0表示不限制，均分后仍为0
+			s.policy = c.newPolicy(c.cacheBytes/int64(n), func(key string, value lru.Value) {
+				c.onEvicted(s, key, value)
+			})
+			c.shards[i] = s
+		}
+	})
+}
+
+// fnv-1a，避免把key转换成[]byte
+func (c *cache) shard(key string) *cacheShard {
+	c.init()
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return c.shards[h%uint32(len(c.shards))]
 }
 
 func (c *cache) add(key string, value ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil) //lazy init
+	expire := value.Expire()
+	if !expire.IsZero() {
+		expire = expire.Add(c.grace)
+	}
+	s := c.shard(key)
+	s.mu.Lock()
+	before := s.policy.Bytes()
+	s.policy.AddWithExpire(key, value, expire)
+	c.account(s, before)
+	spilled := len(s.spilled) > 0
+	s.mu.Unlock()
+	if spilled {
+		c.flushSpill(s)
 	}
-	c.lru.Add(key, value)
+	//出现会过期的条目时，才启动后台清理
+	if !value.Expire().IsZero() && c.sweepInterval > 0 {
+		c.sweepOnce.Do(func() { go c.sweep() })
+	}
+	enforceMemoryLimit()
+}
+
+// 根据操作前后policy的大小更新c.nbytes与arbiter.used，需持有s.mu
+func (c *cache) account(s *cacheShard, before int64) {
+	if d := s.policy.Bytes() - before; d != 0 {
+		atomic.AddInt64(&c.nbytes, d)
+		if s.tracked {
+			atomic.AddInt64(&arbiter.used, d)
+		}
+	}
+}
+
+// 从arbiter.used中扣除，之后的变化也不再计入
+func (c *cache) untrack() {
+	c.init()
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if s.tracked {
+			s.tracked = false
+			atomic.AddInt64(&arbiter.used, -s.policy.Bytes())
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (c *cache) bytes() int64 {
+	return atomic.LoadInt64(&c.nbytes)
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nget++
+	before := s.policy.Bytes()
+	v, ok := s.policy.Get(key)
+	if !ok {
+		c.account(s, before) //可能惰性删除了过期条目
+		return
+	}
+	s.nhit++
+	return v.(ByteView), true
+}
+
+// 在持有s.mu时被policy回调
+func (c *cache) onEvicted(s *cacheShard, key string, value lru.Value) {
+	s.nevict++
+	if c.spill != nil && !s.remove {
+		if v := value.(ByteView); !v.expired(time.Now()) {
+			s.spilled = append(s.spilled, spillEntry{key, v})
+		}
+	}
+}
+
+// 把淘汰的条目交给spill，调用时不能持有s.mu
+func (c *cache) flushSpill(s *cacheShard) {
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	s.mu.Lock()
+	entries := s.spilled
+	s.spilled = nil
+	s.mu.Unlock()
+	for _, e := range entries {
+		c.spill(e.key, e.value)
+	}
+}
+
+// 丢弃key等待交给spill的旧值，并等待正在进行的spill完成，
+// 之后删除磁盘中的key，不会再被旧值覆盖
+func (c *cache) cancelSpill(key string) {
+	if c.spill == nil {
+		return
+	}
+	c.cancelShardSpill(c.shard(key), func(k string) bool { return k == key })
+}
+
+// 同cancelSpill，作用于所有以prefix开头的key
+func (c *cache) cancelSpillPrefix(prefix string) {
+	if c.spill == nil {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), true
+	c.init()
+	for _, s := range c.shards {
+		c.cancelShardSpill(s, func(k string) bool { return strings.HasPrefix(k, prefix) })
 	}
-	return
+}
+
+func (c *cache) cancelShardSpill(s *cacheShard, match func(key string) bool) {
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.spilled[:0]
+	for _, e := range s.spilled {
+		if !match(e.key) {
+			kept = append(kept, e)
+		}
+	}
+	s.spilled = kept
+}
+
+// 汇总所有分片的统计
+func (c *cache) stats() CacheStats {
+	c.init()
+	var st CacheStats
+	for _, s := range c.shards {
+		s.mu.Lock()
+		st.Gets += s.nget
+		st.Hits += s.nhit
+		st.Evictions += s.nevict
+		st.Bytes += s.policy.Bytes()
+		st.Items += int64(s.policy.Len())
+		s.mu.Unlock()
+	}
+	return st
+}
+
+func (c *cache) remove(key string) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := s.policy.Bytes()
+	s.remove = true
+	s.policy.Remove(key)
+	s.remove = false
+	c.account(s, before)
+}
+
+// 删除所有以prefix开头的条目，返回删除的条目数
+func (c *cache) removePrefix(prefix string) int {
+	c.init()
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		var keys []string
+		s.policy.Range(func(key string, value lru.Value, expire time.Time) bool {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		before := s.policy.Bytes()
+		s.remove = true
+		for _, key := range keys {
+			s.policy.Remove(key)
+		}
+		s.remove = false
+		c.account(s, before)
+		s.mu.Unlock()
+		n += len(keys)
+	}
+	return n
+}
+
+// 淘汰占用内存最多的分片中最旧的条目，返回是否淘汰了条目
+func (c *cache) removeOldest() bool {
+	c.init()
+	var victim *cacheShard
+	var most int64
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if b := s.policy.Bytes(); b > most {
+			victim, most = s, b
+		}
+		s.mu.Unlock()
+	}
+	if victim == nil {
+		return false
+	}
+	victim.mu.Lock()
+	before := victim.policy.Bytes()
+	victim.policy.RemoveOldest()
+	c.account(victim, before)
+	removed := victim.policy.Bytes() < before
+	spilled := len(victim.spilled) > 0
+	victim.mu.Unlock()
+	if spilled {
+		c.flushSpill(victim)
+	}
+	return removed
+}
+
+// 遍历所有未过期的条目，f返回false时停止
+// 每次只复制一个分片的条目，调用f时不持有锁
+func (c *cache) rangeEntries(f func(key string, value ByteView) bool) {
+	c.init()
+	type kv struct {
+		key   string
+		value ByteView
+	}
+	for _, s := range c.shards {
+		var entries []kv
+		now := time.Now()
+		s.mu.Lock()
+		s.policy.Range(func(key string, value lru.Value, expire time.Time) bool {
+			if expire.IsZero() || now.Before(expire) {
+				entries = append(entries, kv{key, value.(ByteView)})
+			}
+			return true
+		})
+		s.mu.Unlock()
+		for _, e := range entries {
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// 删除已过期的条目，逐个分片加锁
+func (c *cache) removeExpired() {
+	c.init()
+	for _, s := range c.shards {
+		s.mu.Lock()
+		before := s.policy.Bytes()
+		s.policy.RemoveExpired()
+		c.account(s, before)
+		s.mu.Unlock()
+	}
+}
+
+// 定期清理过期条目，直到close
+func (c *cache) sweep() {
+	t := time.NewTicker(c.sweepInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.removeExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// 停止后台清理，之后仍然可以读写
+func (c *cache) close() {
+	c.init()
+	c.stopOnce.Do(func() { close(c.stop) })
 }
@@ -0,0 +1,107 @@
+package geecache
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCacheShards(t *testing.T) {
+	c := &cache{cacheBytes: 64 << 10, nshards: 8}
+	for i := 0; i < 100; i++ {
+		c.add(strconv.Itoa(i), ByteView{b: []byte("value")})
+	}
+	if len(c.shards) != 8 {
+		t.Fatalf("expect 8 shards, got %d", len(c.shards))
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := c.get(strconv.Itoa(i)); !ok || v.String() != "value" {
+			t.Fatalf("key %d lost", i)
+		}
+	}
+	if s := c.stats(); s.Items != 100 || s.Gets != 100 || s.Hits != 100 {
+		t.Fatalf("stats should sum up all shards, got %+v", s)
+	}
+
+	//容量不足时减少分片数
+	small := &cache{cacheBytes: 2 << 10, nshards: 8}
+	small.add("key", ByteView{b: []byte("value")})
+	if len(small.shards) != 1 {
+		t.Fatalf("small cache should not be sharded, got %d shards", len(small.shards))
+	}
+}
+
+func TestSweepStop(t *testing.T) {
+	c := &cache{sweepInterval: time.Millisecond}
+	c.add("k", ByteView{b: []byte("v"), e: time.Now().Add(5 * time.Millisecond)})
+	c.close()
+	c.close()
+	c.add("k2", ByteView{b: []byte("v"), e: time.Now().Add(5 * time.Millisecond)})
+	time.Sleep(20 * time.Millisecond)
+	//停止后不再清理，过期的条目留到下次访问时删除
+	if s := c.stats(); s.Items != 2 {
+		t.Fatalf("sweep should stop after close, got %d items", s.Items)
+	}
+}
+
+// spill在释放分片的锁后调用，写磁盘时不阻塞同一分片的读写
+func TestSpillOutsideLock(t *testing.T) {
+	var c *cache
+	var spilled []string
+	c = &cache{cacheBytes: 10, nshards: 1, spill: func(key string, value ByteView) {
+		c.get(key) //持有锁时调用会死锁
+		spilled = append(spilled, key)
+	}}
+	c.add("k1", ByteView{b: []byte("value")})
+	c.add("k2", ByteView{b: []byte("value")})
+	if len(spilled) != 1 || spilled[0] != "k1" {
+		t.Fatalf("evicted k1 should be spilled, got %v", spilled)
+	}
+
+	//取消后，等待中的条目不再写入
+	c.add("k3", ByteView{b: []byte("value")})
+	c.shards[0].spilled = append(c.shards[0].spilled, spillEntry{"k9", ByteView{b: []byte("old")}})
+	c.cancelSpill("k9")
+	c.add("k4", ByteView{b: []byte("value")})
+	for _, key := range spilled {
+		if key == "k9" {
+			t.Fatal("cancelled entry should not be spilled")
+		}
+	}
+}
+
+// 所有key都已在缓存中，测试并发命中时的吞吐
+// 1个分片等同于分片前所有读写共用一把锁，用-cpu参数比较不同并发下的差异
+func benchmarkGroupGet(b *testing.B, shards int) {
+	const keys = 1 << 12
+	name := fmt.Sprintf("bench-shards-%d", shards)
+	gee := NewGroup(name, 64<<20, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }), WithShards(shards))
+	for i := 0; i < keys; i++ {
+		gee.Get(strconv.Itoa(i))
+	}
+	//命中时的日志会掩盖锁的开销
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			gee.Get(strconv.Itoa(i & (keys - 1)))
+			i++
+		}
+	})
+}
+
+func BenchmarkGroupGet1Shard(b *testing.B) {
+	benchmarkGroupGet(b, 1)
+}
+
+func BenchmarkGroupGet16Shards(b *testing.B) {
+	benchmarkGroupGet(b, 16)
+}
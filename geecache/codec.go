@@ -0,0 +1,214 @@
+package geecache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+)
+
+// Codec 压缩与解压value，Name会随value一起传给其他节点，
+// 对方需要注册同名的Codec才能解压
+type Codec interface {
+	Name() string
+	Encode(src []byte) ([]byte, error)
+	Decode(src []byte) ([]byte, error)
+}
+
+// 内置的压缩方式，通过WithCodec选择
+var (
+	Gzip Codec = gzipCodec{}
+	LZ   Codec = lzCodec{}
+)
+
+var (
+	codecMu sync.RWMutex
+	codecs  = map[string]Codec{Gzip.Name(): Gzip, LZ.Name(): LZ}
+)
+
+// 注册自定义的Codec，用于解压其他节点发来的value
+func RegisterCodec(c Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// 根据名字查找Codec，name为空表示未压缩
+func codecByName(name string) (Codec, error) {
+	if name == "" {
+		return nil, nil
+	}
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	if c, ok := codecs[name]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("geecache: unknown codec %q", name)
+}
+
+func codecName(c Codec) string {
+	if c == nil {
+		return ""
+	}
+	return c.Name()
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// 简单的LZ77压缩，格式与LZ4 block类似，不依赖第三方库
+// 格式: 原始长度(uvarint) | 序列...
+// 序列: token(高4位字面量长度，低4位匹配长度-4，为15时后接uvarint补充) |
+// 字面量 | 匹配偏移(2字节小端) | 匹配长度补充
+// 最后一个序列只有字面量
+const (
+	lzMinMatch  = 4
+	lzMaxOffset = 1<<16 - 1
+	lzHashBits  = 14
+)
+
+var errLZCorrupt = errors.New("geecache: corrupt lz data")
+
+type lzCodec struct{}
+
+func (lzCodec) Name() string { return "lz" }
+
+func (lzCodec) Encode(src []byte) ([]byte, error) {
+	dst := make([]byte, binary.MaxVarintLen64, len(src)/2+16)
+	dst = dst[:binary.PutUvarint(dst, uint64(len(src)))]
+	var table [1 << lzHashBits]int32 //4字节序列的哈希 -> 最近出现的位置+1
+	anchor := 0
+	for i := 0; i+lzMinMatch <= len(src); {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 2654435761) >> (32 - lzHashBits)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if cand < 0 || i-cand > lzMaxOffset || binary.LittleEndian.Uint32(src[cand:]) != seq {
+			i++
+			continue
+		}
+		m := lzMinMatch
+		for i+m < len(src) && src[cand+m] == src[i+m] {
+			m++
+		}
+		dst = lzAppendSeq(dst, src[anchor:i], i-cand, m)
+		i += m
+		anchor = i
+	}
+	return lzAppendSeq(dst, src[anchor:], 0, 0), nil
+}
+
+// match为0时表示最后一个序列
+func lzAppendSeq(dst, lit []byte, offset, match int) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	token := byte(min15(len(lit)) << 4)
+	if match > 0 {
+		token |= byte(min15(match - lzMinMatch))
+	}
+	dst = append(dst, token)
+	if len(lit) >= 15 {
+		dst = append(dst, buf[:binary.PutUvarint(buf[:], uint64(len(lit)-15))]...)
+	}
+	dst = append(dst, lit...)
+	if match == 0 {
+		return dst
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if match-lzMinMatch >= 15 {
+		dst = append(dst, buf[:binary.PutUvarint(buf[:], uint64(match-lzMinMatch-15))]...)
+	}
+	return dst
+}
+
+func min15(n int) int {
+	if n > 15 {
+		return 15
+	}
+	return n
+}
+
+func (lzCodec) Decode(src []byte) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 || n > math.MaxInt32 {
+		return nil, errLZCorrupt
+	}
+	//原始长度来自输入，可能被篡改，预分配的容量不超过输入的若干倍
+	size := int(n)
+	if size > len(src)*8 {
+		size = len(src) * 8
+	}
+	dst := make([]byte, 0, size)
+	readLen := func(p, base int) (int, int, error) {
+		if base < 15 {
+			return base, p, nil
+		}
+		v, k := binary.Uvarint(src[p:])
+		if k <= 0 || v > n {
+			return 0, 0, errLZCorrupt
+		}
+		return base + int(v), p + k, nil
+	}
+	var lit, match, next int
+	var err error
+	for p := k; p < len(src); {
+		token := src[p]
+		lit, next, err = readLen(p+1, int(token>>4))
+		p = next
+		if err != nil || lit > len(src)-p {
+			return nil, errLZCorrupt
+		}
+		dst = append(dst, src[p:p+lit]...)
+		p += lit
+		if p == len(src) {
+			break
+		}
+		if p+2 > len(src) {
+			return nil, errLZCorrupt
+		}
+		offset := int(src[p]) | int(src[p+1])<<8
+		match, next, err = readLen(p+2, int(token&15))
+		if err != nil {
+			return nil, errLZCorrupt
+		}
+		p = next
+		match += lzMinMatch
+		if offset == 0 || offset > len(dst) || uint64(len(dst)+match) > n {
+			return nil, errLZCorrupt
+		}
+		//匹配区域可能与输出重叠，逐字节复制
+		start := len(dst) - offset
+		for j := 0; j < match; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, errLZCorrupt
+	}
+	return dst, nil
+}
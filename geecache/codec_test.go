@@ -0,0 +1,112 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	pb "geecache/geecachepb"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func jsonBlob(n int) []byte {
+	var b strings.Builder
+	b.WriteString("[")
+	for i := 0; i < n; i++ {
+		b.WriteString(`{"name":"Tom","score":630,"tags":["a","b","c"]},`)
+	}
+	b.WriteString("{}]")
+	return []byte(b.String())
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs := map[string][]byte{
+		"empty":  {},
+		"short":  []byte("abc"),
+		"json":   jsonBlob(200),
+		"random": random,
+		"zeros":  make([]byte, 1<<20),
+	}
+	for _, c := range []Codec{Gzip, LZ} {
+		for name, in := range inputs {
+			enc, err := c.Encode(in)
+			if err != nil {
+				t.Fatalf("%s %s: %v", c.Name(), name, err)
+			}
+			dec, err := c.Decode(enc)
+			if err != nil || !bytes.Equal(dec, in) {
+				t.Fatalf("%s %s: round trip failed: %v", c.Name(), name, err)
+			}
+			if name == "json" && len(enc) > len(in)/4 {
+				t.Fatalf("%s should compress json well, got %d/%d", c.Name(), len(enc), len(in))
+			}
+		}
+	}
+}
+
+func TestLZCorrupt(t *testing.T) {
+	enc, _ := LZ.Encode(jsonBlob(10))
+	for _, bad := range [][]byte{nil, enc[:len(enc)/2], append([]byte{0xff}, enc[1:]...)} {
+		if _, err := LZ.Decode(bad); err == nil {
+			t.Fatalf("corrupt data %x should fail", bad)
+		}
+	}
+}
+
+func TestByteViewCorrupt(t *testing.T) {
+	enc, _ := Gzip.Encode(jsonBlob(10))
+	v := ByteView{b: enc[:len(enc)/2], c: Gzip}
+	if _, err := v.Bytes(); err == nil {
+		t.Fatal("Bytes should report corrupt data")
+	}
+	if b := v.Byteslice(); b != nil {
+		t.Fatalf("Byteslice should return nil for corrupt data, got %d bytes", len(b))
+	}
+}
+
+func TestGroupCodec(t *testing.T) {
+	blob := jsonBlob(100)
+	gee := NewGroup("codec", 0, GetterFunc(
+		func(key string) ([]byte, error) { return blob, nil }), WithCodec(LZ))
+	view, err := gee.Get("Tom")
+	if err != nil || !bytes.Equal(view.Byteslice(), blob) || view.String() != string(blob) {
+		t.Fatal("value should be decoded on read")
+	}
+	if view.Len() >= len(blob)/4 || gee.Stats().Bytes >= int64(len(blob)/4) {
+		t.Fatalf("value should be stored compressed, got %d bytes", view.Len())
+	}
+
+	//其他节点收到压缩后的value，由请求方解压
+	p := NewHTTPPool("http://localhost:8001")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	res := &pb.Response{}
+	if err := p.newGetter(srv.URL).Get(context.Background(), &pb.Request{Group: "codec", Key: "Tom"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Codec != "lz" || len(res.Value) != view.Len() {
+		t.Fatalf("value should be sent compressed, got codec %q", res.Codec)
+	}
+	remote, err := gee.peerValue("Tom", res.Value, res.Expire, res.Codec)
+	if err != nil || remote.String() != string(blob) {
+		t.Fatalf("caller should decode peer value: %v", err)
+	}
+	if _, err := gee.peerValue("Tom", res.Value, 0, "unknown"); err == nil {
+		t.Fatal("unknown codec should fail")
+	}
+
+	//快照中保留压缩方式
+	var buf bytes.Buffer
+	gee.Snapshot(&buf)
+	restored := NewGroup("codec-restored", 0, GetterFunc(
+		func(key string) ([]byte, error) { return nil, ErrNotFound }))
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := restored.lookupCache("Tom"); !ok || v.String() != string(blob) {
+		t.Fatal("compressed value should survive snapshot")
+	}
+}
@@ -8,11 +8,22 @@ import (
 
 type Hash func(data []byte) uint32
 
+// Picker 根据key选择真实机器节点，Map、Jump、Rendezvous都实现了该接口
+// 权重表示节点的相对容量，权重为2的节点分到的key约为权重为1的两倍
+type Picker interface {
+	Add(keys ...string)
+	AddWeighted(key string, weight int)
+	Remove(keys ...string)
+	Get(key string) string
+	GetN(key string, n int) []string
+}
+
 type Map struct {
 	hash     Hash           //可自定义，默认为crc32.ChecksumIEEE算法
 	replicas int            //虚拟节点倍数
 	keys     []int          //哈希环
 	hasMap   map[int]string //虚拟节点与真实节点的映射表
+	weights  map[string]int //真实节点的权重
 }
 
 func New(replicas int, fn Hash) *Map {
@@ -20,6 +31,7 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hasMap:   make(map[int]string),
+		weights:  make(map[string]int),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -30,13 +42,54 @@ func New(replicas int, fn Hash) *Map {
 // 增加真实机器节点
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
+		m.add(key, 1)
+	}
+	sort.Ints(m.keys)
+}
+
+// 增加带权重的真实机器节点，虚拟节点数为 replicas*weight
+func (m *Map) AddWeighted(key string, weight int) {
+	m.add(key, weight)
+	sort.Ints(m.keys)
+}
+
+func (m *Map) add(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	if _, ok := m.weights[key]; ok {
+		m.Remove(key) //重复添加时以新的权重为准
+	}
+	m.weights[key] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		m.keys = append(m.keys, hash)
+		m.hasMap[hash] = key
+	}
+}
+
+// 删除真实机器节点及其虚拟节点，其余节点在环上的位置不变
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		weight, ok := m.weights[key]
+		if !ok {
+			continue
+		}
+		delete(m.weights, key)
+		for i := 0; i < m.replicas*weight; i++ {
 			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hasMap[hash] = key
+			if m.hasMap[hash] == key {
+				delete(m.hasMap, hash)
+			}
 		}
 	}
-	sort.Ints(m.keys)
+	ring := m.keys[:0]
+	for _, hash := range m.keys {
+		if _, ok := m.hasMap[hash]; ok {
+			ring = append(ring, hash)
+		}
+	}
+	m.keys = ring
 }
 
 // 获取真实机器节点
@@ -54,3 +107,28 @@ func (m *Map) Get(key string) string {
 	//如果为找到，就选0
 	return m.hasMap[m.keys[idx%len(m.keys)]]
 }
+
+// 从key所在位置开始沿环顺时针查找，返回最多n个不同的真实节点
+// 第一个即为Get返回的节点，后续节点用于保存副本
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.weights) {
+		n = len(m.weights)
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	res := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(res) < n; i++ {
+		node := m.hasMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			res = append(res, node)
+		}
+	}
+	return res
+}
@@ -1,6 +1,7 @@
 package consistenthash
 
 import (
+	"fmt"
 	"strconv"
 	"testing"
 )
@@ -35,3 +36,138 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2", "8")
+	// Removes 8, 18, 28
+	hash.Remove("8")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s %s", k, v, hash.Get(k))
+		}
+	}
+	hash.Remove("6", "4", "2")
+	if hash.Get("2") != "" {
+		t.Errorf("empty ring should yield nothing")
+	}
+}
+
+func newPickers() map[string]Picker {
+	return map[string]Picker{
+		"ring":       New(200, nil),
+		"jump":       NewJump(nil),
+		"rendezvous": NewRendezvous(nil),
+	}
+}
+
+func nodeName(i int) string {
+	return fmt.Sprintf("http://10.0.0.%d:8001", i+10)
+}
+
+func owners(p Picker, n int) []string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = p.Get("key" + strconv.Itoa(i))
+	}
+	return res
+}
+
+func TestBalance(t *testing.T) {
+	const nodes, keys = 10, 100000
+	for name, p := range newPickers() {
+		for i := 0; i < nodes; i++ {
+			p.Add(nodeName(i))
+		}
+		counts := make(map[string]int)
+		for _, owner := range owners(p, keys) {
+			counts[owner]++
+		}
+		for node, c := range counts {
+			if ratio := float64(c) * nodes / keys; ratio < 0.7 || ratio > 1.3 {
+				t.Errorf("%s: %s got %d keys, too far from average", name, node, c)
+			}
+		}
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	const keys = 100000
+	for name, p := range newPickers() {
+		p.Add(nodeName(0), nodeName(1))
+		p.AddWeighted(nodeName(2), 2)
+		counts := make(map[string]int)
+		for _, owner := range owners(p, keys) {
+			counts[owner]++
+		}
+		//权重为2的节点应该分到一半左右的key
+		if ratio := float64(counts[nodeName(2)]) / keys; ratio < 0.4 || ratio > 0.6 {
+			t.Errorf("%s: weighted node got %.2f of keys, expect 0.5", name, ratio)
+		}
+	}
+}
+
+func TestKeyMovement(t *testing.T) {
+	const nodes, keys = 10, 100000
+	for name, p := range newPickers() {
+		for i := 0; i < nodes; i++ {
+			p.Add(nodeName(i))
+		}
+		before := owners(p, keys)
+
+		//新节点排在最后，理想情况下只有1/11的key移动到新节点
+		p.Add(nodeName(nodes))
+		after := owners(p, keys)
+		moved := 0
+		for i := range before {
+			if before[i] != after[i] {
+				moved++
+				if after[i] != nodeName(nodes) {
+					t.Fatalf("%s: key moved between old nodes", name)
+				}
+			}
+		}
+		if ratio := float64(moved) / keys; ratio > 1.5/(nodes+1) {
+			t.Errorf("%s: %.3f of keys moved after adding a node", name, ratio)
+		}
+
+		//删除节点后，只有属于该节点的key移动
+		p.Remove(nodeName(nodes))
+		for i, owner := range owners(p, keys) {
+			if owner != before[i] {
+				t.Fatalf("%s: key%d should move back to %s", name, i, before[i])
+			}
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	for name, p := range newPickers() {
+		for i := 0; i < 5; i++ {
+			p.Add(nodeName(i))
+		}
+		for i := 0; i < 100; i++ {
+			key := "key" + strconv.Itoa(i)
+			nodes := p.GetN(key, 3)
+			if len(nodes) != 3 || nodes[0] != p.Get(key) {
+				t.Fatalf("%s: GetN should start with the owner, got %v", name, nodes)
+			}
+			if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+				t.Fatalf("%s: GetN should return distinct nodes, got %v", name, nodes)
+			}
+		}
+		if len(p.GetN("key", 10)) != 5 {
+			t.Fatalf("%s: GetN should be limited by the number of nodes", name)
+		}
+	}
+}
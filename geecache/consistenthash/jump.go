@@ -0,0 +1,103 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"sort"
+)
+
+// Jump 跳跃一致性哈希(Jump Consistent Hash)
+// 不需要虚拟节点，内存占用小且分布均匀，
+// 但节点按名字排序后编号，只有在末尾增删节点时移动的key最少
+type Jump struct {
+	hash    Hash
+	nodes   []string       //排序后的真实节点
+	weights map[string]int //真实节点的权重
+	buckets []string       //每个节点按权重占据若干个桶
+}
+
+func NewJump(fn Hash) *Jump {
+	j := &Jump{
+		hash:    fn,
+		weights: make(map[string]int),
+	}
+	if j.hash == nil {
+		j.hash = crc32.ChecksumIEEE
+	}
+	return j
+}
+
+func (j *Jump) Add(keys ...string) {
+	for _, key := range keys {
+		j.weights[key] = 1
+	}
+	j.rebuild()
+}
+
+func (j *Jump) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	j.weights[key] = weight
+	j.rebuild()
+}
+
+func (j *Jump) Remove(keys ...string) {
+	for _, key := range keys {
+		delete(j.weights, key)
+	}
+	j.rebuild()
+}
+
+func (j *Jump) Get(key string) string {
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[jumpHash(uint64(j.hash([]byte(key))), len(j.buckets))]
+}
+
+// 按节点名排序，保证所有机器上桶的编号一致
+func (j *Jump) rebuild() {
+	j.nodes = j.nodes[:0]
+	for node := range j.weights {
+		j.nodes = append(j.nodes, node)
+	}
+	sort.Strings(j.nodes)
+	j.buckets = j.buckets[:0]
+	for _, node := range j.nodes {
+		for i := 0; i < j.weights[node]; i++ {
+			j.buckets = append(j.buckets, node)
+		}
+	}
+}
+
+// Lamping & Veach, "A Fast, Minimal Memory, Consistent Hash Algorithm"
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// 从key所在的桶开始依次向后取，返回最多n个不同的真实节点
+func (j *Jump) GetN(key string, n int) []string {
+	if len(j.buckets) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+	b := jumpHash(uint64(j.hash([]byte(key))), len(j.buckets))
+	res := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(j.buckets) && len(res) < n; i++ {
+		node := j.buckets[(b+i)%len(j.buckets)]
+		if !seen[node] {
+			seen[node] = true
+			res = append(res, node)
+		}
+	}
+	return res
+}
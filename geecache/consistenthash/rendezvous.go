@@ -0,0 +1,105 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"math"
+	"sort"
+)
+
+// Rendezvous 最高随机权重哈希(HRW)
+// 对每个节点计算 hash(节点+key) 得分，取得分最高的节点，
+// 增删节点时只有属于该节点的key会移动，Get的复杂度为O(节点数)
+type Rendezvous struct {
+	hash    Hash
+	nodes   []string
+	weights map[string]int
+}
+
+func NewRendezvous(fn Hash) *Rendezvous {
+	r := &Rendezvous{
+		hash:    fn,
+		weights: make(map[string]int),
+	}
+	if r.hash == nil {
+		r.hash = crc32.ChecksumIEEE
+	}
+	return r
+}
+
+func (r *Rendezvous) Add(keys ...string) {
+	for _, key := range keys {
+		r.AddWeighted(key, 1)
+	}
+}
+
+func (r *Rendezvous) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	if _, ok := r.weights[key]; !ok {
+		r.nodes = append(r.nodes, key)
+		sort.Strings(r.nodes)
+	}
+	r.weights[key] = weight
+}
+
+func (r *Rendezvous) Remove(keys ...string) {
+	for _, key := range keys {
+		if _, ok := r.weights[key]; !ok {
+			continue
+		}
+		delete(r.weights, key)
+		i := sort.SearchStrings(r.nodes, key)
+		r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+	}
+}
+
+func (r *Rendezvous) Get(key string) string {
+	var (
+		best  string
+		score = math.Inf(-1)
+	)
+	for _, node := range r.nodes {
+		if s := r.score(node, key); s > score {
+			best, score = node, s
+		}
+	}
+	return best
+}
+
+// 加权得分 -w/ln(u)，u为(0,1)上均匀分布的哈希值
+// 各节点胜出的概率与权重成正比
+func (r *Rendezvous) score(node, key string) float64 {
+	h := mix(r.hash([]byte(node + key)))
+	u := (float64(h) + 0.5) / (1 << 32)
+	return -float64(r.weights[node]) / math.Log(u)
+}
+
+// 对哈希值再做一次混淆，避免crc32等线性哈希在相似输入上的偏差
+func mix(h uint32) uint32 {
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// 按得分从高到低返回最多n个节点
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	res := append([]string(nil), r.nodes...)
+	scores := make(map[string]float64, len(res))
+	for _, node := range res {
+		scores[node] = r.score(node, key)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return scores[res[i]] > scores[res[j]]
+	})
+	if n < len(res) {
+		res = res[:n]
+	}
+	return res
+}
@@ -0,0 +1,416 @@
+package disk
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 只追加写的磁盘存储，所有记录保存在一个日志文件中，内存中维护key到记录位置的索引
+//
+// 记录格式(小端):
+//
+//	crc32(4) | op(1) | expire(8) | keyLen(4) | valueLen(4) | key | value
+//
+// crc32覆盖op之后的所有字节；expire为UnixNano，0表示永不过期；删除记录没有value
+// 打开时顺序扫描日志重建索引，遇到不完整或校验失败的记录(写入时崩溃)就从该处截断
+const (
+	headerSize = 4 + 1 + 8 + 4 + 4
+	opPut      = 1
+	opDelete   = 2
+
+	logName = "data.log"
+	tmpName = "data.log.tmp"
+
+	minCompactBytes = 64 << 10 //无效记录达到该大小且超过有效记录时才压缩
+	maxKeySize      = 1 << 16
+)
+
+var (
+	ErrTooLarge = errors.New("disk: entry is larger than the store")
+	ErrClosed   = errors.New("disk: store is closed")
+)
+
+// 索引中的一条记录，按写入顺序保存在链表中，超出容量时从最旧的开始淘汰
+type entry struct {
+	key    string
+	offset int64 //记录在文件中的起始位置
+	size   int64 //记录的总长度
+	expire int64
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return e.expire != 0 && now.UnixNano() > e.expire
+}
+
+type Store struct {
+	mu       sync.Mutex
+	dir      string
+	f        *os.File
+	size     int64 //文件中有效数据的末尾，也是下一条记录的位置
+	live     int64 //索引中记录的总长度
+	maxBytes int64 //live的上限，为0时不限制
+	ll       *list.List
+	index    map[string]*list.Element
+	closed   bool
+}
+
+// 打开dir下的存储，不存在时创建，并从日志恢复索引
+// maxBytes为有效记录的总大小上限，日志文件在压缩前最多约为它的两倍
+func Open(dir string, maxBytes int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	os.Remove(filepath.Join(dir, tmpName)) //上次压缩没有完成
+	f, err := os.OpenFile(filepath.Join(dir, logName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:      dir,
+		f:        f,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		index:    make(map[string]*list.Element),
+	}
+	if err = s.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// 顺序重放日志，截断末尾损坏的部分
+func (s *Store) recover() error {
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.f, 0, info.Size()))
+	var offset int64
+	for {
+		op, expire, key, size, err := readRecord(r, info.Size()-offset)
+		if err != nil {
+			break
+		}
+		s.drop(key)
+		if op == opPut {
+			//已过期的记录也参与淘汰，保证淘汰的顺序与写入时一致，
+			//否则写入时已被淘汰的旧值可能重新出现
+			s.add(&entry{key: key, offset: offset, size: size, expire: expire})
+		}
+		offset += size
+	}
+	now := time.Now()
+	for ele := s.ll.Front(); ele != nil; {
+		next := ele.Next()
+		if ele.Value.(*entry).expired(now) {
+			s.removeElement(ele)
+		}
+		ele = next
+	}
+	if offset < info.Size() {
+		log.Printf("[GeeCache] disk store %s: truncating %d corrupt bytes", s.dir, info.Size()-offset)
+		if err = s.f.Truncate(offset); err != nil {
+			return err
+		}
+	}
+	s.size = offset
+	return nil
+}
+
+// 读取一条记录并校验，value只用于计算校验和
+func readRecord(r io.Reader, remain int64) (op byte, expire int64, key string, size int64, err error) {
+	var h [headerSize]byte
+	if _, err = io.ReadFull(r, h[:]); err != nil {
+		return
+	}
+	keyLen := int64(binary.LittleEndian.Uint32(h[13:]))
+	valueLen := int64(binary.LittleEndian.Uint32(h[17:]))
+	size = headerSize + keyLen + valueLen
+	if keyLen > maxKeySize || size > remain {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	body := make([]byte, keyLen+valueLen)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(h[4:])
+	crc.Write(body)
+	if crc.Sum32() != binary.LittleEndian.Uint32(h[:4]) {
+		err = errors.New("disk: checksum mismatch")
+		return
+	}
+	op = h[4]
+	expire = int64(binary.LittleEndian.Uint64(h[5:]))
+	key = string(body[:keyLen])
+	return
+}
+
+func encodeRecord(op byte, key string, value []byte, expire int64) []byte {
+	buf := make([]byte, headerSize+len(key)+len(value))
+	buf[4] = op
+	binary.LittleEndian.PutUint64(buf[5:], uint64(expire))
+	binary.LittleEndian.PutUint32(buf[13:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[17:], uint32(len(value)))
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// 将记录加入索引，超出容量时淘汰最旧的记录
+// 淘汰不写删除记录，重放日志时按同样的顺序淘汰，得到相同的索引
+func (s *Store) add(e *entry) {
+	s.index[e.key] = s.ll.PushBack(e)
+	s.live += e.size
+	for s.maxBytes > 0 && s.live > s.maxBytes {
+		s.removeElement(s.ll.Front())
+	}
+}
+
+// 从索引中删除key，不写日志
+func (s *Store) drop(key string) {
+	if ele, ok := s.index[key]; ok {
+		s.removeElement(ele)
+	}
+}
+
+func (s *Store) removeElement(ele *list.Element) {
+	e := s.ll.Remove(ele).(*entry)
+	delete(s.index, e.key)
+	s.live -= e.size
+}
+
+// 追加一条记录，写入失败时下一条记录会覆盖这里
+func (s *Store) append(buf []byte) (int64, error) {
+	offset := s.size
+	if _, err := s.f.WriteAt(buf, offset); err != nil {
+		return 0, err
+	}
+	s.size += int64(len(buf))
+	return offset, nil
+}
+
+// 写入key，expire为零值表示永不过期
+func (s *Store) Put(key string, value []byte, expire time.Time) error {
+	var exp int64
+	if !expire.IsZero() {
+		exp = expire.UnixNano()
+	}
+	buf := encodeRecord(opPut, key, value, exp)
+	if len(key) > maxKeySize || (s.maxBytes > 0 && int64(len(buf)) > s.maxBytes) {
+		return ErrTooLarge
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	offset, err := s.append(buf)
+	if err != nil {
+		return err
+	}
+	s.drop(key)
+	s.add(&entry{key: key, offset: offset, size: int64(len(buf)), expire: exp})
+	return s.maybeCompact()
+}
+
+// 读取key，不存在、已过期或记录损坏时返回false
+// 已过期或损坏的记录会被删除，同样写入删除记录
+func (s *Store) Get(key string) (value []byte, expire time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ele, ok := s.index[key]
+	if !ok || s.closed {
+		return nil, time.Time{}, false
+	}
+	e := ele.Value.(*entry)
+	if e.expired(time.Now()) {
+		s.delete(key)
+		return nil, time.Time{}, false
+	}
+	buf := make([]byte, e.size)
+	if _, err := s.f.ReadAt(buf, e.offset); err != nil ||
+		crc32.ChecksumIEEE(buf[4:]) != binary.LittleEndian.Uint32(buf) {
+		log.Printf("[GeeCache] disk store %s: bad record for %s", s.dir, key)
+		s.delete(key)
+		return nil, time.Time{}, false
+	}
+	value = buf[headerSize+len(key):]
+	if e.expire != 0 {
+		expire = time.Unix(0, e.expire)
+	}
+	return value, expire, true
+}
+
+// 判断是否存在未过期的key
+func (s *Store) Contains(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ele, ok := s.index[key]
+	return ok && !ele.Value.(*entry).expired(time.Now())
+}
+
+// 删除key(包括已过期的)，写入删除记录，保证恢复后不会重新出现
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[key]; !ok {
+		return nil
+	}
+	if s.closed {
+		return ErrClosed
+	}
+	return s.delete(key)
+}
+
+// 从索引中删除key并写入删除记录，需持有mu
+// 索引的每次变化都要记录在日志中，否则重放时淘汰的顺序与运行时不同
+// 写入失败时仍从索引中删除，最坏情况下重启后旧值重新出现
+func (s *Store) delete(key string) error {
+	_, err := s.append(encodeRecord(opDelete, key, nil, 0))
+	s.drop(key)
+	if err != nil {
+		return err
+	}
+	return s.maybeCompact()
+}
+
+// 按写入顺序返回所有未过期的key
+func (s *Store) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	keys := make([]string, 0, s.ll.Len())
+	for ele := s.ll.Front(); ele != nil; ele = ele.Next() {
+		if e := ele.Value.(*entry); !e.expired(now) {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys
+}
+
+// 记录数
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+// 有效记录的总字节数
+func (s *Store) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.live
+}
+
+// 日志文件的大小，包括已失效的记录
+func (s *Store) FileSize() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// 无效记录多于有效记录时压缩
+func (s *Store) maybeCompact() error {
+	garbage := s.size - s.live
+	if garbage < minCompactBytes || garbage <= s.live {
+		return nil
+	}
+	return s.compact()
+}
+
+// 压缩日志，只保留有效的记录
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.compact()
+}
+
+// 按索引顺序把有效记录写入临时文件，同步后替换原文件
+// 替换是原子的，任何时候崩溃都只会留下旧文件或新文件
+func (s *Store) compact() error {
+	tmpPath := filepath.Join(s.dir, tmpName)
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	now := time.Now()
+	var offset int64
+	offsets := make(map[*entry]int64, s.ll.Len())
+	for ele := s.ll.Front(); ele != nil; {
+		next := ele.Next()
+		e := ele.Value.(*entry)
+		if e.expired(now) {
+			s.removeElement(ele)
+			ele = next
+			continue
+		}
+		if _, err = io.Copy(w, io.NewSectionReader(s.f, e.offset, e.size)); err != nil {
+			break
+		}
+		offsets[e] = offset
+		offset += e.size
+		ele = next
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filepath.Join(s.dir, logName))
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(s.dir)
+	s.f.Close()
+	s.f = tmp
+	s.size = offset
+	for e, off := range offsets {
+		e.offset = off
+	}
+	return nil
+}
+
+// 同步目录，保证rename被持久化，部分平台不支持，忽略错误
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// 同步并关闭文件，之后的写入返回ErrClosed
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if err := s.f.Sync(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
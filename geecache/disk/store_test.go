@@ -0,0 +1,144 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPutGetDelete(t *testing.T) {
+	s, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Put("k1", []byte("v1"), time.Time{})
+	s.Put("k2", []byte("v2"), time.Now().Add(-time.Second))
+	if v, _, ok := s.Get("k1"); !ok || string(v) != "v1" {
+		t.Fatalf("get k1 failed")
+	}
+	if _, _, ok := s.Get("k2"); ok {
+		t.Fatalf("expired k2 should miss")
+	}
+	s.Delete("k1")
+	if s.Contains("k1") || s.Len() != 0 || s.Bytes() != 0 {
+		t.Fatalf("k1 should be deleted")
+	}
+}
+
+func TestBudget(t *testing.T) {
+	size := int64(headerSize + len("k0") + len("value"))
+	s, err := Open(t.TempDir(), 2*size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := 0; i < 3; i++ {
+		s.Put(fmt.Sprintf("k%d", i), []byte("value"), time.Time{})
+	}
+	if s.Contains("k0") || !s.Contains("k1") || !s.Contains("k2") || s.Bytes() != 2*size {
+		t.Fatalf("oldest entry should be evicted")
+	}
+	if err = s.Put("big", make([]byte, 3*size), time.Time{}); err != ErrTooLarge {
+		t.Fatalf("expect ErrTooLarge, got %v", err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	size := int64(headerSize + len("k0") + len("value"))
+	s, err := Open(dir, 3*size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		s.Put(fmt.Sprintf("k%d", i), []byte("value"), time.Time{})
+	}
+	s.Delete("k2")
+	s.Put("k1", []byte("vaLue"), time.Time{})
+	s.Close()
+
+	//模拟写入最后一条记录时崩溃
+	path := filepath.Join(dir, logName)
+	info, _ := os.Stat(path)
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write(encodeRecord(opPut, "torn", []byte("value"), 0)[:10])
+	f.Close()
+
+	s, err = Open(dir, 3*size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Contains("k0") || s.Contains("k2") || s.Contains("torn") || s.Len() != 2 {
+		t.Fatalf("index should be rebuilt from the log, got %d entries", s.Len())
+	}
+	if v, _, ok := s.Get("k1"); !ok || string(v) != "vaLue" {
+		t.Fatalf("recovered k1 should have the latest value, got %s", v)
+	}
+	if s.FileSize() != info.Size() {
+		t.Fatalf("torn record should be truncated")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		s.Put("k", []byte(fmt.Sprint(i)), time.Time{})
+	}
+	s.Put("other", []byte("v"), time.Time{})
+	if err = s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if s.FileSize() != s.Bytes() {
+		t.Fatalf("compacted file should only keep live records")
+	}
+	if v, _, ok := s.Get("k"); !ok || string(v) != "99" {
+		t.Fatalf("k should survive compaction, got %s", v)
+	}
+	s.Close()
+
+	s, err = Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if v, _, ok := s.Get("other"); !ok || string(v) != "v" || s.Len() != 2 {
+		t.Fatalf("compacted log should be recoverable")
+	}
+}
+
+func TestRecoverAfterExpiredGet(t *testing.T) {
+	dir := t.TempDir()
+	size := int64(headerSize + len("k0") + len("value"))
+	s, err := Open(dir, 3*size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("k0", []byte("value"), time.Time{})
+	s.Put("k1", []byte("value"), time.Now().Add(10*time.Millisecond))
+	s.Put("k2", []byte("value"), time.Time{})
+	time.Sleep(20 * time.Millisecond)
+	//读取时删除已过期的k1，腾出的空间让k3不必淘汰k0
+	if _, _, ok := s.Get("k1"); ok {
+		t.Fatal("expired k1 should miss")
+	}
+	s.Put("k3", []byte("value"), time.Time{})
+	want := fmt.Sprint(s.Keys())
+	s.Close()
+
+	s, err = Open(dir, 3*size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := fmt.Sprint(s.Keys()); got != want {
+		t.Fatalf("recovered index should match the runtime one, want %s, got %s", want, got)
+	}
+}
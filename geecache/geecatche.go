@@ -1,11 +1,18 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"geecache/disk"
 	pb "geecache/geecachepb"
 	"geecache/singleflight"
 	"log"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 // 函数类型实现某一个接口，称之为接口型函数，
@@ -16,6 +23,10 @@ type Getter interface {
 	Get(key string) ([]byte, error)
 }
 
+// ErrNotFound 由Getter返回(可以被包装)，表示数据源中不存在该key
+// Group会在negCache中缓存这一结果，并以NotFound响应告知其他节点
+var ErrNotFound = errors.New("geecache: key not found")
+
 // 回调函数
 type GetterFunc func(key string) ([]byte, error)
 
@@ -24,12 +35,80 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// TTLGetter 在返回数据的同时返回该条目的存活时间，
+// 存活时间为0时使用Group的默认过期时间
+type TTLGetter interface {
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// 带存活时间的回调函数
+type TTLGetterFunc func(key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// 实现Getter，使TTLGetterFunc可以直接传给NewGroup
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+// ContextGetter 可以感知加载的超时(见WithLoadTimeout)，Group会优先使用该接口
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// 带context的回调函数
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// 实现Getter，使ContextGetterFunc可以直接传给NewGroup
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
 type Group struct {
 	name      string //该缓存的名字
 	getter    Getter //缓存未命中时，获取资源的回调
 	mainCache cache
+	hotCache  cache         //缓存部分从其他节点获取的热点数据，避免每次都请求所属节点
+	hotSample float64       //从其他节点获取的值放入hotCache的比例，为0时不启用
+	negCache  cache         //缓存不存在的key，避免反复请求数据源
+	negTTL    time.Duration //不存在的结果缓存多久，为0时不启用negCache
 	peers     PerrPicker
 	loader    *singleflight.Group //去保证同一时间相同的key只会请求一次
+	ttl       time.Duration       //默认过期时间，0表示永不过期
+	weight    float64             //共享全局内存上限时的权重
+	hitRate   hitRate             //近期命中数，用于计算边际价值
+	codec     Codec               //保存和传输value时的压缩方式，为nil时不压缩
+	setter    Setter              //Set时写入数据源，为nil时只写缓存
+	writer    *writeBehind        //不为nil时由后台批量写入setter
+	spanHook  SpanHook            //不为nil时接收缓存命中、节点获取与数据源加载的span
+	limiter   loadLimiter         //限制数据源加载的并发数与速率
+	stats     groupStats
+
+	refreshAhead time.Duration //命中的条目距过期不足该时间时，在后台提前刷新
+	refreshing   sync.Map      //正在后台刷新的key
+
+	snapshotDir      string        //不为空时启动时从中恢复快照
+	snapshotInterval time.Duration //定期保存快照的周期
+	snapshotStop     chan struct{} //关闭后停止定期保存
+	snapshotDone     chan struct{} //定期保存的goroutine退出后关闭
+	closeOnce        sync.Once
+
+	loadTimeout     time.Duration //一次合并加载的超时时间，为0时不限制
+	peerTimeout     time.Duration //请求其他节点的超时时间，为0时不限制
+	hedgePercentile float64       //按节点耗时的该分位数决定对冲延迟，为0时不对冲
+	hedgeFallback   time.Duration //节点耗时样本不足时使用的对冲延迟
+	latencies       sync.Map      //节点地址(见latencyKey) -> *latencyTracker
+
+	diskDir   string      //不为空时启用磁盘上的第二层缓存
+	diskBytes int64       //磁盘缓存的容量
+	diskStore *disk.Store //打开失败时为nil
 }
 
 var (
@@ -37,20 +116,43 @@ var (
 	groups = make(map[string]*Group)
 )
 
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
-	mu.Lock()
-	defer mu.Unlock()
-
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:        name,
+		getter:      getter,
+		mainCache:   cache{cacheBytes: cacheBytes, nshards: defaultShards, sweepInterval: defaultSweepInterval, tracked: true},
+		hotCache:    cache{sweepInterval: defaultSweepInterval, tracked: true},
+		negCache:    cache{cacheBytes: cacheBytes / defaultNegativeRatio, sweepInterval: defaultSweepInterval, tracked: true},
+		negTTL:      defaultNegativeTTL,
+		loadTimeout: defaultLoadTimeout,
+		weight:      defaultWeight,
+		loader:      &singleflight.Group{},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.writer != nil {
+		g.writer.start()
 	}
+	if g.diskDir != "" {
+		g.openDisk()
+	}
+	mu.Lock()
+	old := groups[name]
 	groups[name] = g
+	mu.Unlock()
+	//被替换的group不再使用，停止它的后台清理，不再计入全局内存
+	if old != nil {
+		old.stopSweep()
+		old.untrack()
+	}
+	//恢复快照时会检查全局内存上限，需要在释放mu之后
+	if g.snapshotDir != "" {
+		g.startSnapshot(g.snapshotDir, g.snapshotInterval)
+	}
 	return g
 }
 
@@ -63,64 +165,591 @@ func GetGroup(name string) *Group {
 
 // key :eg Tom
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// ctx中的值(如调用链)会传递给其他节点的请求和Getter，超时与取消只限制当前调用方的等待，
+// ctx结束时不再等待正在进行的加载，直接返回ctx.Err()；加载本身受WithLoadTimeout限制
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
-	if v, ok := g.mainCache.get(key); ok {
+	g.stats.Gets.Add(1)
+	v, c, ok := g.lookup(key)
+	now := time.Now()
+	if ok && !v.expired(now) {
+		g.stats.CacheHits.Add(1)
 		log.Println("[GeeCache]hit")
+		if g.spanHook != nil {
+			_, span := g.startSpan(ctx, SpanCacheHit, key)
+			g.endSpan(span, nil)
+		}
+		if g.refreshAhead > 0 && !v.e.IsZero() && v.e.Sub(now) < g.refreshAhead {
+			g.refresh(key, c)
+		}
+		return v, nil
+	}
+	if !ok {
+		if v, ok := g.lookupDisk(key); ok {
+			g.stats.DiskHits.Add(1)
+			return v, nil
+		}
+	}
+	if g.lookupNegative(key) {
+		g.stats.NegativeHits.Add(1)
+		return ByteView{}, ErrNotFound
+	}
+	//缓存未命中，或者只剩宽限期内的旧值
+	view, err := g.load(ctx, key)
+	if err != nil && ok && !errors.Is(err, ErrNotFound) {
+		g.stats.StaleServes.Add(1)
+		log.Println("[GeeCache] Serving stale value,", err)
 		return v, nil
 	}
-	//缓存未命中
-	return g.load(key)
+	return view, err
+}
+
+// 在后台通过loader重新加载key，同一个key同时只有一个刷新
+// 刷新期间调用方仍然得到旧值，成功后写回旧值所在的cache
+func (g *Group) refresh(key string, c *cache) {
+	if _, loaded := g.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	g.stats.Refreshes.Add(1)
+	go func() {
+		defer g.refreshing.Delete(key)
+		view, err, _ := g.loader.Do(key, func() (interface{}, error) {
+			return g.loadFromPeerOrLocally(context.Background(), key)
+		})
+		if err != nil {
+			g.stats.RefreshErrs.Add(1)
+			log.Println("[GeeCache] Failed to refresh", key, err)
+			return
+		}
+		c.add(key, view.(ByteView))
+	}()
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
-	view, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			//缓存未命中，先从其他节点寻找
-			if peer, ok := g.peers.PickPeer(key); ok {
-				//从其他节点获取
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+// 相同key的加载通过singleflight合并，ctx结束时当前调用方放弃等待，
+// 加载本身继续进行，不影响合并进来的其他调用方
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	g.stats.Loads.Add(1)
+	executed := false //结果返回时fn已经结束，不存在并发读写
+	view, err, _ := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		executed = true
+		loadCtx, cancel := g.detach(ctx)
+		defer cancel()
+		return g.loadFromPeerOrLocally(loadCtx, key)
+	})
+	if err != nil && err == ctx.Err() {
+		return ByteView{}, err //放弃等待，fn可能仍在执行
+	}
+	if !executed {
+		g.stats.LoadsDeduped.Add(1)
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
+
+// 返回的ctx只保留ctx中的值(如调用链)，不随ctx取消，截止时间由loadTimeout决定
+// 合并后的加载由多个调用方共享，不应受第一个调用方的取消或截止时间影响，
+// 每个调用方的ctx只限制它自己的等待(见DoContext)
+func (g *Group) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	base := context.Context(valueOnlyContext{ctx})
+	if g.loadTimeout > 0 {
+		return context.WithTimeout(base, g.loadTimeout)
+	}
+	return context.WithCancel(base)
+}
+
+// 只保留ctx中的值
+type valueOnlyContext struct{ context.Context }
+
+func (valueOnlyContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valueOnlyContext) Done() <-chan struct{}       { return nil }
+func (valueOnlyContext) Err() error                  { return nil }
+
+// 一个候选的加载结果，peer为nil表示本机通过Getter加载
+type loadResult struct {
+	view ByteView
+	err  error
+	peer PeerGetter
+}
+
+// 缓存未命中时，按副本顺序依次询问排在本机之前的节点，
+// 都失败后才通过Getter加载，避免某个节点宕机时所有节点同时请求数据源
+// 开启对冲时，当前候选超过对冲延迟仍未返回，就同时请求下一个候选，
+// 使用最先成功的结果并取消其余请求
+func (g *Group) loadFromPeerOrLocally(ctx context.Context, key string) (interface{}, error) {
+	peers, pos := g.replicas(key, false)
+	if pos >= 0 {
+		peers = peers[:pos]
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() //返回时取消其余仍在进行的请求
+
+	results := make(chan loadResult, len(peers)+1)
+	var hedge <-chan time.Time
+	var timers []*time.Timer
+	defer func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+	}()
+	next, running := 0, 0
+	start := func() {
+		i := next
+		next++
+		running++
+		hedge = nil
+		if i == len(peers) {
+			//保存到本机,（根据一致性算法分配给了自己或者未分配）
+			go func() {
+				view, err := g.getLocally(ctx, key)
+				results <- loadResult{view: view, err: err}
+			}()
+			return
+		}
+		go func() {
+			//从其他节点获取
+			view, err := g.getFromPeer(ctx, peers[i], key)
+			results <- loadResult{view: view, err: err, peer: peers[i]}
+		}()
+		if d := g.hedgeDelay(peers[i]); d > 0 {
+			t := time.NewTimer(d)
+			timers = append(timers, t)
+			hedge = t.C
+		}
+	}
+
+	start()
+	var lastErr error
+	for running > 0 {
+		select {
+		case <-hedge:
+			g.stats.Hedges.Add(1)
+			start()
+			continue
+		case res := <-results:
+			running--
+			if res.peer == nil {
+				if res.err == nil {
+					g.stats.LocalLoads.Add(1)
+					return res.view, nil
+				}
+				g.stats.LocalLoadErrs.Add(1)
+				if errors.Is(res.err, ErrNotFound) {
+					return nil, res.err
+				}
+			} else if res.err == nil || errors.Is(res.err, ErrNotFound) {
+				g.stats.PeerLoads.Add(1)
+				if res.err != nil {
+					return nil, res.err //对方已确认不存在，不必再请求数据源
 				}
-				log.Println("[GeeCache] Failed to get from peer", err)
+				if pos >= 0 {
+					g.populateCache(key, res.view) //本机也是副本，保存一份
+				}
+				return res.view, nil
+			} else {
+				g.stats.PeerErrors.Add(1)
+				log.Println("[GeeCache] Failed to get from peer", res.err)
 			}
+			lastErr = res.err
+		}
+		if parent.Err() != nil {
+			return nil, parent.Err()
+		}
+		//失败后立即尝试下一个候选
+		if next <= len(peers) {
+			start()
 		}
-		//保存到本机,（根据一致性算法分配给了自己或者未分配）
-		return g.getLocally(key)
-	})
-	if err == nil {
-		return view.(ByteView), nil
 	}
-	return
-}  
+	return nil, lastErr
+}
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+// 返回key的副本节点，含义同ReplicaPicker，all为true时包括暂时不可用的节点
+// 未实现ReplicaPicker时，只有PickPeer返回的所属节点
+func (g *Group) replicas(key string, all bool) ([]PeerGetter, int) {
+	if g.peers == nil {
+		return nil, 0
+	}
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		if all {
+			return rp.AllReplicas(key)
+		}
+		return rp.PickReplicas(key)
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}, -1
+	}
+	return nil, 0
+}
+
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	if g.peerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.peerTimeout)
+		defer cancel()
+	}
+	ctx, span := g.startSpan(ctx, SpanPeerFetch, key)
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
+	traceRequest(ctx, req)
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	start := time.Now()
+	err := peer.Get(ctx, req, res)
+	if err == nil {
+		g.recordLatency(peer, time.Since(start))
+	}
+	if err == nil && res.NotFound {
+		g.populateNegative(key)
+		err = ErrNotFound
+	}
+	g.endSpan(span, err)
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	return g.peerValue(key, res.Value, res.Expire, res.Codec)
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+// 将其他节点返回的值包装为ByteView，保持对方的压缩方式
+func (g *Group) peerValue(key string, b []byte, expire int64, codec string) (ByteView, error) {
+	c, err := codecByName(codec)
+	if err != nil {
+		return ByteView{}, err
+	}
+	value := ByteView{b: b, e: fromUnixNano(expire), c: c}
+	//只抽样一部分放入hotCache，访问越频繁的key越容易被缓存下来
+	if g.hotSample > 0 && rand.Float64() < g.hotSample {
+		g.hotCache.add(key, value)
+	}
+	return value, nil
+}
+
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		bytes   []byte
+		ttl     time.Duration
+		err     error
+		pending bool
+	)
+	//write-behind还没写入数据源时，数据源中是旧值
+	if g.writer != nil {
+		bytes, pending = g.writer.lookup(key)
+	}
+	if !pending {
+		var release func()
+		if release, err = g.acquireLoad(ctx, key); err != nil {
+			return ByteView{}, err
+		}
+		defer release()
+		var span *Span
+		ctx, span = g.startSpan(ctx, SpanBackendLoad, key)
+		if cg, ok := g.getter.(ContextGetter); ok {
+			bytes, err = cg.GetContext(ctx, key)
+		} else if tg, ok := g.getter.(TTLGetter); ok {
+			bytes, ttl, err = tg.GetWithTTL(key)
+		} else {
+			bytes, err = g.getter.Get(key)
+		}
+		g.endSpan(span, err)
+	}
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			g.populateNegative(key)
+		}
+		return ByteView{}, err
+	}
+	value, err := g.newView(bytes, g.expireAt(ttl))
 	if err != nil {
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
 	g.populateCache(key, value)
 	return value, nil
 
 }
 
+// 复制b并按g.codec压缩，压缩后没有变小时保存原始数据
+func (g *Group) newView(b []byte, expire time.Time) (ByteView, error) {
+	if g.codec == nil {
+		return ByteView{b: cloneBytes(b), e: expire}, nil
+	}
+	enc, err := g.codec.Encode(b)
+	if err != nil {
+		return ByteView{}, err
+	}
+	if len(enc) >= len(b) {
+		return ByteView{b: cloneBytes(b), e: expire}, nil
+	}
+	return ByteView{b: enc, e: expire, c: g.codec}, nil
+}
+
+// 计算过期时间，ttl为0时使用默认过期时间
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
 func (g *Group) populateCache(key string, value ByteView) {
+	//先删除磁盘中的旧值，add淘汰的条目(包括key自己)会重新写入磁盘
+	g.removeDisk(key)
 	g.mainCache.add(key, value)
+	if g.negTTL > 0 {
+		g.negCache.remove(key)
+	}
+}
+
+// 记录key不存在，negTTL后过期
+func (g *Group) populateNegative(key string) {
+	if g.negTTL > 0 {
+		g.negCache.add(key, ByteView{e: time.Now().Add(g.negTTL)})
+	}
+}
+
+func (g *Group) lookupNegative(key string) bool {
+	if g.negTTL <= 0 {
+		return false
+	}
+	_, ok := g.negCache.get(key)
+	return ok
+}
+
+// 依次查找mainCache和hotCache，只返回未过期的值
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	v, _, ok := g.lookup(key)
+	if !ok || v.expired(time.Now()) {
+		return ByteView{}, false
+	}
+	return v, true
+}
+
+// 同lookupCache，但也会返回宽限期内的旧值，以及它所在的cache
+func (g *Group) lookup(key string) (ByteView, *cache, bool) {
+	if v, ok := g.mainCache.get(key); ok {
+		return v, &g.mainCache, true
+	}
+	if g.hotSample > 0 {
+		if v, ok := g.hotCache.get(key); ok {
+			return v, &g.hotCache, true
+		}
+	}
+	return ByteView{}, nil, false
+}
+
+// 删除本机上的缓存，包括热点副本和不存在的记录
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+	g.removeDisk(key)
+}
+
+// 主动写入缓存，ttl为0时使用默认过期时间
+// 设置了Setter时，write-through先写入数据源，失败时不更新缓存；
+// write-behind加入队列后由后台写入
+// 写入key的所有副本节点；本机不是副本时，删除本地可能存在的旧副本
+// 启用了hotCache时，通知其他节点删除热点副本，见dropHotCopies
+// 所有副本(包括暂时不可用的)都会被写入，返回遇到的第一个错误
+func (g *Group) Set(key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.setter != nil && (g.writer == nil || !g.writer.enqueue(key, cloneBytes(value))) {
+		if err := g.writeBackend(key, value); err != nil {
+			return err
+		}
+	}
+	view, err := g.newView(value, g.expireAt(ttl))
+	if err != nil {
+		return err
+	}
+	peers, pos := g.replicas(key, true)
+	req := &pb.SetRequest{
+		Group:  g.name,
+		Key:    key,
+		Value:  view.b,
+		Expire: unixNano(view.e),
+		Codec:  codecName(view.c),
+	}
+	var firstErr error
+	for _, peer := range peers {
+		if err := peer.Set(context.Background(), req); err != nil && firstErr == nil {
+			firstErr = &peerError{err}
+		}
+	}
+	if pos >= 0 || len(peers) == 0 {
+		g.populateCache(key, view)
+	} else {
+		g.removeLocally(key)
+	}
+	if err := g.dropHotCopies(key, peers); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// 启用了hotCache时，通知不是副本的节点删除key，避免它们在写入或删除后继续返回热点副本中的旧值
+// 假设集群中的节点使用相同的配置；没有启用hotCache时只需要通知副本节点
+func (g *Group) dropHotCopies(key string, replicas []PeerGetter) error {
+	if g.hotSample <= 0 || g.peers == nil {
+		return nil
+	}
+	isReplica := make(map[PeerGetter]bool, len(replicas))
+	for _, peer := range replicas {
+		isReplica[peer] = true
+	}
+	var firstErr error
+	for _, peer := range g.peers.GetAll() {
+		if isReplica[peer] {
+			continue
+		}
+		if err := peer.Remove(context.Background(), &pb.Request{Group: g.name, Key: key}); err != nil && firstErr == nil {
+			firstErr = &peerError{err}
+		}
+	}
+	return firstErr
+}
+
+// 写完write-behind积压的数据并停止后台写入，之后的Set同步写入数据源
+// 停止后台清理与定期保存快照，保存最后一次快照，关闭磁盘缓存，返回遇到的第一个错误
+func (g *Group) Close() error {
+	var err error
+	if g.writer != nil {
+		err = g.writer.close()
+	}
+	g.closeOnce.Do(func() {
+		g.stopSweep()
+		if g.snapshotDir != "" {
+			if serr := g.stopSnapshot(); err == nil {
+				err = serr
+			}
+		}
+	})
+	if g.diskStore != nil {
+		if cerr := g.diskStore.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// 停止所有cache的后台清理
+func (g *Group) stopSweep() {
+	g.mainCache.close()
+	g.hotCache.close()
+	g.negCache.close()
+}
+
+// 删除本机以及key所有副本节点(包括暂时不可用的)上的缓存
+// 启用了hotCache时，其他节点的热点副本也会被删除
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.removeLocally(key)
+	peers, _ := g.replicas(key, true)
+	var firstErr error
+	for _, peer := range peers {
+		if err := peer.Remove(context.Background(), &pb.Request{Group: g.name, Key: key}); err != nil && firstErr == nil {
+			firstErr = &peerError{err}
+		}
+	}
+	if err := g.dropHotCopies(key, peers); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// 通知集群中所有节点删除key的本地缓存
+// 所有节点都会被通知到，返回遇到的第一个错误
+func (g *Group) Invalidate(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.removeLocally(key)
+	if g.peers == nil {
+		return nil
+	}
+	var firstErr error
+	for _, peer := range g.peers.GetAll() {
+		if err := peer.Remove(context.Background(), &pb.Request{Group: g.name, Key: key}); err != nil {
+			log.Println("[GeeCache] Failed to invalidate on peer", err)
+			if firstErr == nil {
+				firstErr = &peerError{err}
+			}
+		}
+	}
+	return firstErr
+}
+
+// 返回本机缓存中所有以prefix开头的key，按字典序排列
+// 只包含本机mainCache与hotCache中未过期的条目，不查询其他节点
+func (g *Group) Keys(prefix string) []string {
+	seen := make(map[string]struct{})
+	for _, c := range []*cache{&g.mainCache, &g.hotCache} {
+		c.rangeEntries(func(key string, value ByteView) bool {
+			if strings.HasPrefix(key, prefix) {
+				seen[key] = struct{}{}
+			}
+			return true
+		})
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 删除本机所有以prefix开头的缓存，返回删除的条目数
+func (g *Group) removePrefixLocally(prefix string) int {
+	return g.mainCache.removePrefix(prefix) + g.hotCache.removePrefix(prefix) +
+		g.negCache.removePrefix(prefix) + g.removeDiskPrefix(prefix)
+}
+
+// 通知集群中所有节点删除以prefix开头的本地缓存，例如"user:42:"下的所有key
+// prefix为空时删除所有缓存；所有节点都会被通知到，返回遇到的第一个错误
+func (g *Group) RemovePrefix(prefix string) error {
+	g.removePrefixLocally(prefix)
+	if g.peers == nil {
+		return nil
+	}
+	var firstErr error
+	for _, peer := range g.peers.GetAll() {
+		if err := peer.RemovePrefix(context.Background(), &pb.Request{Group: g.name, Key: prefix}); err != nil {
+			log.Println("[GeeCache] Failed to remove prefix on peer", err)
+			if firstErr == nil {
+				firstErr = &peerError{err}
+			}
+		}
+	}
+	return firstErr
+}
+
+// time.Time与UnixNano之间的转换，零值对应0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
 }
 
 // 注册peers,也就是注册分布式
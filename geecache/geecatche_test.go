@@ -1,10 +1,17 @@
 package geecache
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	pb "geecache/geecachepb"
 	"log"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -66,6 +73,578 @@ func TestGetGroup(t *testing.T) {
 	}
 }
 
+func TestExpiration(t *testing.T) {
+	loads := 0
+	gee := NewGroup("expiration", 2<<10, TTLGetterFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loads++
+			if key == "short" {
+				return []byte(key), 10 * time.Millisecond, nil
+			}
+			return []byte(key), 0, nil
+		}), WithExpiration(time.Hour))
+
+	if view, err := gee.Get("short"); err != nil || view.Expire().IsZero() {
+		t.Fatal("getter ttl should set expire time")
+	}
+	if view, err := gee.Get("long"); err != nil || time.Until(view.Expire()) < 59*time.Minute {
+		t.Fatal("default ttl should be used when getter returns 0")
+	}
+	time.Sleep(20 * time.Millisecond)
+	gee.Get("short")
+	gee.Get("long")
+	if loads != 3 {
+		t.Fatalf("expired key should be reloaded, got %d loads", loads)
+	}
+}
+
+// 测试用的节点，记录收到的请求
+type fakePeer struct {
+	sets      map[string][]byte
+	removed   []string
+	gets      int
+	multis    int
+	down      bool            //模拟宕机，Get与GetMulti返回错误
+	lastReq   *pb.Request     //最后一次Get的请求
+	lastMulti []string        //最后一次GetMulti请求的key
+	removeErr error           //Remove返回的错误
+	failKeys  map[string]bool //GetMulti中返回加载失败的key
+}
+
+func (p *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.gets++
+	p.lastReq = in
+	if p.down {
+		return fmt.Errorf("peer is down")
+	}
+	v, ok := p.sets[in.Key]
+	out.Value, out.NotFound = v, !ok
+	return nil
+}
+
+func (p *fakePeer) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	p.multis++
+	p.lastMulti = in.Keys
+	if p.down {
+		return fmt.Errorf("peer is down")
+	}
+	for _, key := range in.Keys {
+		if p.failKeys[key] {
+			out.Items = append(out.Items, &pb.Item{Key: key, Error: "backend is down"})
+		} else if v, ok := p.sets[key]; ok {
+			out.Items = append(out.Items, &pb.Item{Key: key, Value: v})
+		} else {
+			out.Items = append(out.Items, &pb.Item{Key: key, NotFound: true})
+		}
+	}
+	return nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, in *pb.SetRequest) error {
+	p.sets[in.Key] = in.Value
+	return nil
+}
+
+func (p *fakePeer) Remove(ctx context.Context, in *pb.Request) error {
+	p.removed = append(p.removed, in.Key)
+	return p.removeErr
+}
+
+func (p *fakePeer) RemovePrefix(ctx context.Context, in *pb.Request) error {
+	p.removed = append(p.removed, in.Key+"*")
+	return nil
+}
+
+// key以"remote"开头的属于owner节点
+type fakePicker struct {
+	owner *fakePeer
+	all   []PeerGetter
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote") {
+		return p.owner, true
+	}
+	return nil, false
+}
+
+func (p *fakePicker) GetAll() []PeerGetter {
+	return p.all
+}
+
+func TestSetRemoveInvalidate(t *testing.T) {
+	owner := &fakePeer{sets: map[string][]byte{}}
+	other := &fakePeer{sets: map[string][]byte{}}
+	gee := NewGroup("setremove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("db"), nil }))
+	gee.RegisterPeers(&fakePicker{owner: owner, all: []PeerGetter{owner, other}})
+
+	if err := gee.Set("local", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := gee.Get("local"); err != nil || view.String() != "v1" {
+		t.Fatalf("Set should populate local cache, got %s", view)
+	}
+	if err := gee.Remove("local"); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get("local"); view.String() != "db" {
+		t.Fatalf("Remove should drop local value, got %s", view)
+	}
+
+	if err := gee.Set("remote1", []byte("v2"), 0); err != nil || string(owner.sets["remote1"]) != "v2" {
+		t.Fatal("Set should be routed to the owner")
+	}
+	if err := gee.Remove("remote1"); err != nil || !reflect.DeepEqual(owner.removed, []string{"remote1"}) {
+		t.Fatal("Remove should be routed to the owner")
+	}
+	if err := gee.Invalidate("local"); err != nil || len(owner.removed) != 2 || len(other.removed) != 1 {
+		t.Fatal("Invalidate should be sent to all peers")
+	}
+
+	//节点返回的错误可以与本机的错误区分
+	owner.removeErr = fmt.Errorf("peer is down")
+	var pe *peerError
+	if err := gee.Remove("remote1"); !errors.As(err, &pe) {
+		t.Fatalf("Remove should wrap peer errors, got %v", err)
+	}
+}
+
+func TestSetDropsHotCopies(t *testing.T) {
+	owner := &fakePeer{sets: map[string][]byte{}}
+	other := &fakePeer{sets: map[string][]byte{}}
+	gee := NewGroup("hotdrop", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("db"), nil }), WithHotCache(1<<10, 1))
+	gee.RegisterPeers(&fakePicker{owner: owner, all: []PeerGetter{owner, other}})
+
+	//其他节点可能有热点副本，写入与删除后需要通知它们
+	if err := gee.Set("remote1", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := gee.Remove("remote1"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(other.removed, []string{"remote1", "remote1"}) || !reflect.DeepEqual(owner.removed, []string{"remote1"}) {
+		t.Fatalf("hot copies should be dropped on non-replicas, got %v and %v", other.removed, owner.removed)
+	}
+}
+
+func TestKeysRemovePrefix(t *testing.T) {
+	peer := &fakePeer{sets: map[string][]byte{}}
+	gee := NewGroup("removeprefix", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	gee.RegisterPeers(&fakePicker{all: []PeerGetter{peer}})
+	for _, key := range []string{"user:42:name", "user:42:age", "user:420:name", "user:7:name"} {
+		gee.Get(key)
+	}
+	if keys := gee.Keys("user:42"); !reflect.DeepEqual(keys, []string{"user:420:name", "user:42:age", "user:42:name"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if err := gee.RemovePrefix("user:42:"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := gee.Keys(""); !reflect.DeepEqual(keys, []string{"user:420:name", "user:7:name"}) {
+		t.Fatalf("RemovePrefix should only drop matching keys, left %v", keys)
+	}
+	if !reflect.DeepEqual(peer.removed, []string{"user:42:*"}) {
+		t.Fatalf("RemovePrefix should be sent to all peers, got %v", peer.removed)
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	owner := &fakePeer{sets: map[string][]byte{"remote1": []byte("v1")}}
+	gee := NewGroup("hotcache", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("db"), nil }), WithHotCache(1<<10, 1))
+	gee.RegisterPeers(&fakePicker{owner: owner, all: []PeerGetter{owner}})
+
+	for i := 0; i < 3; i++ {
+		if view, err := gee.Get("remote1"); err != nil || view.String() != "v1" {
+			t.Fatalf("failed to get remote1 from peer, got %s", view)
+		}
+	}
+	if owner.gets != 1 {
+		t.Fatalf("hot key should be served from hotCache, owner got %d requests", owner.gets)
+	}
+	gee.Invalidate("remote1")
+	gee.Get("remote1")
+	if owner.gets != 2 {
+		t.Fatal("Invalidate should drop the hot copy")
+	}
+}
+
+func TestStats(t *testing.T) {
+	gee := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	gee.Get("Tom")
+	gee.Get("Tom")
+	gee.Get("unknown")
+
+	s := gee.Stats()
+	if s.Gets != 3 || s.Hits != 1 || s.Misses != 2 || s.LocalLoads != 1 || s.LocalLoadErrs != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if s.Items != 1 || s.Bytes != int64(len("Tom")+len("630")) {
+		t.Fatalf("unexpected cache size %+v", s)
+	}
+
+	rec := httptest.NewRecorder()
+	NewHTTPPool("http://localhost:8001").ServeHTTP(rec, httptest.NewRequest("GET", "/_geecache_stats/stats", nil))
+	var got Stats
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || got.Gets != 3 {
+		t.Fatalf("stats endpoint returned %+v, %v", got, err)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	gee := NewGroup("context", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			if key == "slow" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			if _, ok := ctx.Deadline(); !ok && key == "fast" {
+				return nil, fmt.Errorf("load timeout should be applied to getter")
+			}
+			return []byte(key), nil
+		}), WithLoadTimeout(time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if view, err := gee.GetContext(ctx, "fast"); err != nil || view.String() != "fast" {
+		t.Fatalf("GetContext failed: %v", err)
+	}
+	if _, err := gee.GetContext(ctx, "slow"); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	//GetterFunc仍然可以使用
+	if view, err := gee.getter.Get("old"); err != nil || string(view) != "old" {
+		t.Fatal("ContextGetterFunc should also implement Getter")
+	}
+}
+
+func TestGetContextShared(t *testing.T) {
+	gee := NewGroup("context-shared", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			select {
+			case <-time.After(30 * time.Millisecond):
+				return []byte(key), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := gee.GetContext(ctx, "Tom")
+		first <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	second := make(chan error)
+	go func() {
+		_, err := gee.Get("Tom")
+		second <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("first caller should give up, got %v", err)
+	}
+	if err := <-second; err != nil {
+		t.Fatalf("other callers should not be cancelled, got %v", err)
+	}
+	if s := gee.Stats(); s.LoadsDeduped != 1 || s.LocalLoads != 1 {
+		t.Fatalf("load should be shared, got %+v", s)
+	}
+
+	//第一个调用方的截止时间只限制它自己的等待，共享的加载继续进行
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		_, err := gee.GetContext(ctx, "Jack")
+		first <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if view, err := gee.Get("Jack"); err != nil || view.String() != "Jack" {
+		t.Fatalf("other callers should not be bound by the first deadline, got %v", err)
+	}
+	if err := <-first; err != context.DeadlineExceeded {
+		t.Fatalf("first caller should stop at its deadline, got %v", err)
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	owner := &fakePeer{sets: map[string][]byte{"remote1": []byte("r1"), "remote2": []byte("r2")}}
+	gee := NewGroup("multi", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	gee.RegisterPeers(&fakePicker{owner: owner, all: []PeerGetter{owner}})
+	gee.Get("Tom")
+
+	keys := []string{"Tom", "Jack", "unknown", "remote1", "remote2", "remote3", "Jack"}
+	views, err := gee.GetMulti(keys)
+	errs, ok := err.(MultiError)
+	if !ok || len(errs) != 2 || errs["unknown"] == nil || errs["remote3"] == nil {
+		t.Fatalf("expect errors for unknown and remote3, got %v", err)
+	}
+	expect := map[string]string{"Tom": "630", "Jack": "589", "remote1": "r1", "remote2": "r2"}
+	if len(views) != len(expect) {
+		t.Fatalf("expect %d values, got %d", len(expect), len(views))
+	}
+	for k, v := range expect {
+		if views[k].String() != v {
+			t.Fatalf("expect %s=%s, got %s", k, v, views[k])
+		}
+	}
+	if owner.multis != 1 || owner.gets != 0 {
+		t.Fatalf("remote keys should be fetched in one batch, got %d batches", owner.multis)
+	}
+
+	//重复的key只请求和统计一次
+	owner.lastMulti = nil
+	gets := gee.Stats().Gets
+	if _, err = gee.GetMulti([]string{"a", "a", "a", "remote4", "remote4"}); err == nil {
+		t.Fatal("a and remote4 should fail")
+	}
+	if n := gee.Stats().Gets - gets; n != 2 || len(owner.lastMulti) != 1 {
+		t.Fatalf("duplicate keys should be counted and sent once, got %d gets, batch %v", n, owner.lastMulti)
+	}
+}
+
+// 按顺序返回replicas，pos为本机所在位置
+type fakeReplicaPicker struct {
+	fakePicker
+	replicas []PeerGetter
+	pos      int
+}
+
+func (p *fakeReplicaPicker) PickReplicas(key string) ([]PeerGetter, int) {
+	return p.replicas, p.pos
+}
+
+func (p *fakeReplicaPicker) AllReplicas(key string) ([]PeerGetter, int) {
+	return p.replicas, p.pos
+}
+
+func TestGetMultiFailover(t *testing.T) {
+	owner := &fakePeer{sets: map[string][]byte{}, down: true}
+	replica := &fakePeer{sets: map[string][]byte{"remote1": []byte("r1")}}
+	loads := 0
+	gee := NewGroup("multifailover", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("db"), nil
+		}))
+	picker := &fakeReplicaPicker{fakePicker: fakePicker{owner: owner}, replicas: []PeerGetter{owner, replica}, pos: -1}
+	gee.RegisterPeers(picker)
+
+	//所属节点批量请求失败，先请求下一个副本，不直接回到数据源
+	views, err := gee.GetMulti([]string{"remote1"})
+	if err != nil || views["remote1"].String() != "r1" || loads != 0 || replica.multis != 1 {
+		t.Fatalf("should fail over to replica, got %v, %v", views, err)
+	}
+
+	//所有副本都失败时在本机加载
+	replica.down = true
+	views, err = gee.GetMulti([]string{"remote2"})
+	if err != nil || views["remote2"].String() != "db" || loads != 1 {
+		t.Fatalf("should load locally after all replicas failed, got %v, %v", views, err)
+	}
+}
+
+func TestGetMultiItemError(t *testing.T) {
+	owner := &fakePeer{sets: map[string][]byte{}, failKeys: map[string]bool{"remote1": true}}
+	replica := &fakePeer{sets: map[string][]byte{"remote1": []byte("r1")}}
+	loads := 0
+	gee := NewGroup("multiitemerr", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("db"), nil
+		}))
+	picker := &fakeReplicaPicker{fakePicker: fakePicker{owner: owner}, replicas: []PeerGetter{owner, replica}, pos: 2}
+	gee.RegisterPeers(picker)
+
+	//所属节点加载单个key失败，同样请求下一个副本，本机也是副本，保存一份
+	views, err := gee.GetMulti([]string{"remote1"})
+	if err != nil || views["remote1"].String() != "r1" || loads != 0 || replica.multis != 1 {
+		t.Fatalf("should fail over to replica, got %v, %v", views, err)
+	}
+	if s := gee.Stats(); s.PeerErrors != 1 {
+		t.Fatalf("per-key error should count as a peer error, got %+v", s)
+	}
+	if _, ok := gee.lookupCache("remote1"); !ok {
+		t.Fatal("replica node should keep the value")
+	}
+
+	//所有副本都加载失败时在本机加载
+	replica.failKeys = map[string]bool{"remote2": true}
+	owner.failKeys["remote2"] = true
+	views, err = gee.GetMulti([]string{"remote2"})
+	if err != nil || views["remote2"].String() != "db" || loads != 1 {
+		t.Fatalf("should load locally after all replicas failed, got %v, %v", views, err)
+	}
+}
+
+func TestReplicaFailover(t *testing.T) {
+	owner := &fakePeer{sets: map[string][]byte{}, down: true}
+	replica := &fakePeer{sets: map[string][]byte{"Tom": []byte("r")}}
+	loads := 0
+	gee := NewGroup("replica", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("db"), nil
+		}))
+	picker := &fakeReplicaPicker{replicas: []PeerGetter{owner, replica}, pos: 2}
+	gee.RegisterPeers(picker)
+
+	//所属节点宕机，从下一个副本读取，本机也是副本，保存一份
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "r" || loads != 0 {
+		t.Fatalf("should fail over to replica, got %s, %v", view, err)
+	}
+	if _, ok := gee.lookupCache("Tom"); !ok {
+		t.Fatal("replica node should keep the value")
+	}
+
+	//排在本机之后的副本不会被询问
+	picker.pos = 0
+	if view, _ := gee.Get("Jack"); view.String() != "db" || replica.gets != 1 {
+		t.Fatalf("first replica should load locally, got %s", view)
+	}
+
+	if err := gee.Set("Sam", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(owner.sets["Sam"]) != "v" || string(replica.sets["Sam"]) != "v" {
+		t.Fatal("Set should be sent to all replicas")
+	}
+	if view, _ := gee.lookupCache("Sam"); view.String() != "v" {
+		t.Fatal("Set should also populate local replica")
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loads := 0
+	gee := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}), WithNegativeCache(1<<10, 20*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 1 || gee.Stats().NegativeHits != 2 {
+		t.Fatalf("not found result should be cached, got %d loads", loads)
+	}
+	time.Sleep(30 * time.Millisecond)
+	gee.Get("unknown")
+	if loads != 2 {
+		t.Fatal("negative entry should expire after ttl")
+	}
+	gee.Set("unknown", []byte("v"), 0)
+	if view, err := gee.Get("unknown"); err != nil || view.String() != "v" {
+		t.Fatalf("Set should replace negative entry, got %v", err)
+	}
+
+	//其他节点返回NotFound时不再请求数据源，并在本机缓存
+	owner := &fakePeer{sets: map[string][]byte{}}
+	gee.RegisterPeers(&fakePicker{owner: owner})
+	for i := 0; i < 2; i++ {
+		if _, err := gee.Get("remote1"); err != ErrNotFound {
+			t.Fatalf("expect ErrNotFound from peer, got %v", err)
+		}
+	}
+	if owner.gets != 1 || loads != 2 {
+		t.Fatalf("peer not found should be cached, got %d peer gets, %d loads", owner.gets, loads)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads AtomicInt
+	gee := NewGroup("refresh", 2<<10, TTLGetterFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			n := loads.Get() + 1
+			loads.Add(1)
+			return []byte(fmt.Sprintf("v%d", n)), 100 * time.Millisecond, nil
+		}), WithRefreshAhead(80*time.Millisecond))
+
+	gee.Get("Tom")
+	time.Sleep(30 * time.Millisecond)
+	//临近过期，返回旧值并在后台刷新
+	if view, _ := gee.Get("Tom"); view.String() != "v1" {
+		t.Fatalf("caller should get the old value during refresh, got %s", view)
+	}
+	for i := 0; i < 100 && loads.Get() < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if view, _ := gee.Get("Tom"); view.String() != "v2" {
+		t.Fatalf("entry should be refreshed in background, got %s", view)
+	}
+	if s := gee.Stats(); s.Refreshes < 1 || loads.Get() > 3 {
+		t.Fatalf("unexpected refreshes %d, loads %d", s.Refreshes, loads.Get())
+	}
+
+	//批量获取命中临近过期的值时也会刷新
+	time.Sleep(30 * time.Millisecond)
+	refreshes := gee.Stats().Refreshes
+	if views, err := gee.GetMulti([]string{"Tom"}); err != nil || views["Tom"].String() != "v2" {
+		t.Fatalf("GetMulti should return the cached value, got %v", err)
+	}
+	if gee.Stats().Refreshes != refreshes+1 {
+		t.Fatal("GetMulti should trigger refresh-ahead")
+	}
+}
+
+func TestStaleGrace(t *testing.T) {
+	var failing bool
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		if failing {
+			return nil, fmt.Errorf("db is down")
+		}
+		return []byte("v1"), nil
+	})
+	gee := NewGroup("stale", 2<<10, getter, WithExpiration(20*time.Millisecond), WithStaleGrace(time.Hour))
+	noGrace := NewGroup("nostale", 2<<10, getter, WithExpiration(20*time.Millisecond))
+	gee.Get("Tom")
+	noGrace.Get("Tom")
+
+	failing = true
+	time.Sleep(30 * time.Millisecond)
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "v1" {
+		t.Fatalf("stale value should be served when db is down, got %v", err)
+	}
+	if gee.Stats().StaleServes != 1 {
+		t.Fatal("stale serve should be counted")
+	}
+	if _, err := noGrace.Get("Tom"); err == nil {
+		t.Fatal("expired value should not be served without grace")
+	}
+	if _, ok := gee.lookupCache("Tom"); ok {
+		t.Fatal("stale value should not count as a cache hit")
+	}
+
+	//批量获取同样返回旧值
+	views, err := gee.GetMulti([]string{"Tom"})
+	if err != nil || views["Tom"].String() != "v1" || gee.Stats().StaleServes != 2 {
+		t.Fatalf("GetMulti should serve the stale value, got %v", err)
+	}
+}
+
 func TestGr(t *testing.T) {
 	p := make(chan struct{},2)
 
@@ -2,4 +2,4 @@ module geecache
 
 go 1.19
 
-require google.golang.org/protobuf v1.28.1 // indirect
+require google.golang.org/protobuf v1.28.1
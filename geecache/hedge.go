@@ -0,0 +1,79 @@
+package geecache
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencySamples  = 128 //每个节点保留最近的请求耗时数
+	minHedgeSamples = 16  //样本数达到后才按百分位计算对冲延迟
+)
+
+// 记录某个节点最近成功请求的耗时
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	n       int //累计记录的次数
+}
+
+func (t *latencyTracker) add(d time.Duration) {
+	t.mu.Lock()
+	t.samples[t.n%latencySamples] = d
+	t.n++
+	t.mu.Unlock()
+}
+
+// 最近耗时的p分位数，样本不足时返回false
+func (t *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	t.mu.Lock()
+	n := t.n
+	if n > latencySamples {
+		n = latencySamples
+	}
+	if n < minHedgeSamples {
+		t.mu.Unlock()
+		return 0, false
+	}
+	s := make([]time.Duration, n)
+	copy(s, t.samples[:n])
+	t.mu.Unlock()
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	i := int(p * float64(n))
+	if i >= n {
+		i = n - 1
+	}
+	return s[i], true
+}
+
+// 按节点地址记录耗时，HTTPPool更新节点列表时会重新创建httpGetter，
+// 按地址记录可以保留样本，并且不会随节点变化无限增长
+func latencyKey(peer PeerGetter) interface{} {
+	if h, ok := peer.(*httpGetter); ok {
+		return h.baseURL
+	}
+	return peer
+}
+
+// 记录一次成功请求的耗时
+func (g *Group) recordLatency(peer PeerGetter, d time.Duration) {
+	if g.hedgePercentile <= 0 {
+		return
+	}
+	t, _ := g.latencies.LoadOrStore(latencyKey(peer), &latencyTracker{})
+	t.(*latencyTracker).add(d)
+}
+
+// 请求peer后等待多久没有结果就同时请求下一个候选，0表示不对冲
+func (g *Group) hedgeDelay(peer PeerGetter) time.Duration {
+	if g.hedgePercentile <= 0 {
+		return 0
+	}
+	if t, ok := g.latencies.Load(latencyKey(peer)); ok {
+		if d, ok := t.(*latencyTracker).percentile(g.hedgePercentile); ok {
+			return d
+		}
+	}
+	return g.hedgeFallback
+}
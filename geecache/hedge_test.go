@@ -0,0 +1,98 @@
+package geecache
+
+import (
+	"context"
+	pb "geecache/geecachepb"
+	"testing"
+	"time"
+)
+
+// 每次Get等待delay后才返回，被取消时关闭cancelled
+type slowPeer struct {
+	*fakePeer
+	delay     time.Duration
+	cancelled chan struct{}
+}
+
+func (p *slowPeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	select {
+	case <-time.After(p.delay):
+		return p.fakePeer.Get(ctx, in, out)
+	case <-ctx.Done():
+		close(p.cancelled)
+		return ctx.Err()
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	var l latencyTracker
+	for i := 1; i < minHedgeSamples; i++ {
+		l.add(time.Millisecond)
+	}
+	if _, ok := l.percentile(0.9); ok {
+		t.Fatal("percentile should not be used before enough samples")
+	}
+	for i := 1; i <= latencySamples; i++ {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	if d, _ := l.percentile(0.5); d != 65*time.Millisecond {
+		t.Fatalf("expect p50 of the last samples to be 65ms, got %v", d)
+	}
+}
+
+func TestHedgedPeerRequest(t *testing.T) {
+	owner := &slowPeer{fakePeer: &fakePeer{sets: map[string][]byte{"Tom": []byte("owner")}}, delay: time.Hour, cancelled: make(chan struct{})}
+	replica := &fakePeer{sets: map[string][]byte{"Tom": []byte("replica")}}
+	gee := NewGroup("hedge", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("db"), nil }), WithHedging(0.95, 10*time.Millisecond))
+	gee.RegisterPeers(&fakeReplicaPicker{replicas: []PeerGetter{owner, replica}, pos: 2})
+
+	//所属节点迟迟不返回，对冲请求下一个副本，并取消对所属节点的请求
+	view, err := gee.Get("Tom")
+	if err != nil || view.String() != "replica" {
+		t.Fatalf("hedged request should win, got %s, %v", view, err)
+	}
+	select {
+	case <-owner.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("slow request should be cancelled")
+	}
+	if s := gee.Stats(); s.Hedges != 1 || s.PeerLoads != 1 || s.PeerErrors != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	//样本足够后按节点的耗时决定对冲延迟
+	for i := 0; i < minHedgeSamples; i++ {
+		gee.recordLatency(replica, time.Second)
+	}
+	if d := gee.hedgeDelay(replica); d != time.Second {
+		t.Fatalf("expect hedge delay from latency samples, got %v", d)
+	}
+	if d := gee.hedgeDelay(owner); d != 10*time.Millisecond {
+		t.Fatalf("expect fallback hedge delay, got %v", d)
+	}
+
+	//同一地址重新创建的节点共用样本
+	p := NewHTTPPool("http://localhost:8001")
+	for i := 0; i < minHedgeSamples; i++ {
+		gee.recordLatency(p.newGetter("http://localhost:8002"), time.Second)
+	}
+	if d := gee.hedgeDelay(p.newGetter("http://localhost:8002")); d != time.Second {
+		t.Fatalf("samples should be kept by peer address, got %v", d)
+	}
+}
+
+func TestGroupPeerTimeout(t *testing.T) {
+	owner := &slowPeer{fakePeer: &fakePeer{sets: map[string][]byte{}}, delay: time.Hour, cancelled: make(chan struct{})}
+	gee := NewGroup("peertimeout", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("db"), nil }), WithPeerTimeout(10*time.Millisecond))
+	gee.RegisterPeers(&fakeReplicaPicker{replicas: []PeerGetter{owner}, pos: -1})
+
+	//所属节点超时后在本机加载
+	if view, err := gee.Get("remote"); err != nil || view.String() != "db" {
+		t.Fatalf("should load locally after peer timeout, got %s, %v", view, err)
+	}
+	if s := gee.Stats(); s.PeerErrors != 1 || s.LocalLoads != 1 || s.Hedges != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
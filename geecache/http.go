@@ -1,38 +1,124 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"geecache/consistenthash"
 	pb "geecache/geecachepb"
+	"geecache/registry"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
 
 const (
-	defaultBasePath = "/_geecache/"
-	defaultReplicas = 50 //默认倍数
+	defaultBasePath       = "/_geecache/"
+	defaultStatsPath      = "/_geecache_stats/"
+	defaultAPIPath        = "/_geecache_api/"
+	defaultSyncInterval   = time.Second * 10 //默认从注册中心同步节点的周期
+	defaultReplicas       = 50               //默认倍数
+	defaultTimeout        = time.Second * 5  //默认请求其他节点的超时时间
+	defaultFailureBackoff = time.Second * 10 //默认节点请求失败后不可用的时间
 )
 
 type HTTPPool struct {
 	self        string
 	basePath    string
+	statsPath   string //统计数据的路径
+	apiPath     string //面向客户端的REST API路径
+	opts        HTTPPoolOptions
+	client      *http.Client           //请求其他节点使用的客户端
 	mu          sync.Mutex             //保护httpGetters
-	peers       *consistenthash.Map    //一致性哈希算法的Map
+	peers       consistenthash.Picker  //选择节点的算法，默认为一致性哈希环
 	httpGetters map[string]*httpGetter //keyed by e.g. "http://10.0.0.2:8008"
+	nonces      nonceCache             //配置了Secret时，记录见过的nonce
+}
+
+// HTTPPoolOptions HTTPPool的可选配置
+type HTTPPoolOptions struct {
+	BasePath  string                       //节点间通信的路径，默认为"/_geecache/"
+	APIPath   string                       //APIHandler处理的路径，默认为"/_geecache_api/"
+	Replicas  int                          //一致性哈希环的虚拟节点倍数，默认为50
+	HashFn    consistenthash.Hash          //哈希函数，默认为crc32
+	NewPicker func() consistenthash.Picker //选择节点的算法，设置后忽略Replicas与HashFn
+	Timeout   time.Duration                //请求其他节点的超时时间，默认为5秒，小于0表示不限制
+
+	//副本数，key保存在环上连续的Replication个节点上，默认为1
+	Replication int
+	//请求失败的节点在这段时间内被视为不可用，默认为10秒，小于0表示不标记
+	FailureBackoff time.Duration
+
+	//双向TLS配置，请求其他节点时使用，并要求其他节点出示经过验证的证书，
+	//此时节点地址应为https://，服务端需要用同样的配置启动，见NewMutualTLSConfig
+	TLSConfig *tls.Config
+	//节点间共享的密钥，不为空时请求会被签名，没有正确签名的请求被拒绝
+	Secret []byte
+	//配置了Secret时，校验签名前最多读取的请求体大小，默认为64MB
+	MaxBodyBytes int64
 }
 
 // 创建实例
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// 使用自定义配置创建实例，o为nil时使用默认配置
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{
+		self:      self,
+		statsPath: defaultStatsPath,
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+	if p.opts.APIPath == "" {
+		p.opts.APIPath = defaultAPIPath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.Replication < 1 {
+		p.opts.Replication = 1
 	}
+	if p.opts.FailureBackoff == 0 {
+		p.opts.FailureBackoff = defaultFailureBackoff
+	}
+	if p.opts.Timeout == 0 {
+		p.opts.Timeout = defaultTimeout
+	}
+	if p.opts.MaxBodyBytes <= 0 {
+		p.opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	p.client = &http.Client{}
+	if p.opts.TLSConfig != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = p.opts.TLSConfig
+		p.client.Transport = t
+	}
+	if p.opts.Timeout > 0 {
+		p.client.Timeout = p.opts.Timeout
+	}
+	if p.opts.NewPicker == nil {
+		p.opts.NewPicker = func() consistenthash.Picker {
+			return consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+		}
+	}
+	p.basePath = p.opts.BasePath
+	p.apiPath = p.opts.APIPath
+	return p
 }
 
 // 自己封装一个log
@@ -41,33 +127,82 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 }
 
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+	isStats := strings.HasPrefix(r.URL.Path, p.statsPath)
+	if !isStats && !strings.HasPrefix(r.URL.Path, p.basePath) {
+		http.NotFound(w, r)
+		return
 	}
 	p.Log("%s %s", r.Method, r.URL.Path)
+	//统计数据与节点间协议在同一个端口上，同样需要认证
+	if err := p.authenticate(w, r); err != nil {
+		p.Log("reject %s: %v", r.RemoteAddr, err)
+		status := http.StatusUnauthorized
+		if errors.Is(err, errBodyTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if isStats {
+		p.serveStats(w, r)
+		return
+	}
 	//"http://localhost:9999/_geecache/soures/Tom"
+	//批量获取时为 POST "http://localhost:9999/_geecache/soures"
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
-	if len(parts) != 2 {
+	if len(parts) != 2 && r.Method != http.MethodPost {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
 	groupName := parts[0]
-	key := parts[1]
-
 	group := GetGroup(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
-	view, err := group.Get(key)
-	if err != nil {
+
+	group.stats.ServerRequests.Add(1)
+	//继续请求方的调用链，并遵守请求方的截止时间
+	ctx, cancel := traceContext(r)
+	defer cancel()
+	r = r.WithContext(ctx)
+	if len(parts) == 1 {
+		p.serveGetMulti(w, r, group)
+		return
+	}
+	key := parts[1]
+	switch r.Method {
+	case http.MethodGet:
+		p.serveGet(w, r, group, key)
+	case http.MethodPut:
+		p.serveSet(w, r, group, key)
+	case http.MethodDelete:
+		//只删除本机的缓存，不再向其他节点转发
+		if r.URL.Query().Get("prefix") != "" {
+			group.removePrefixLocally(key)
+		} else {
+			group.removeLocally(key)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *HTTPPool) serveGet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	//请求方取消或超时后，r.Context()随之结束
+	view, err := group.GetContext(r.Context(), key)
+	//压缩的value原样发送，由请求方解压
+	res := &pb.Response{Value: view.b, Expire: unixNano(view.Expire()), Codec: codecName(view.c)}
+	if errors.Is(err, ErrNotFound) {
+		res.NotFound = true //不存在不是错误，请求方可以据此缓存
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	//利用protbuf将value转换为二进制编码发送给请求方
-	body, err := proto.Marshal(&pb.Response{Value: view.Byteslice()})
+	body, err := proto.Marshal(res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -77,16 +212,113 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+// 批量获取，每个key的错误单独返回
+func (p *HTTPPool) serveGetMulti(w http.ResponseWriter, r *http.Request, group *Group) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.MultiRequest{}
+	if err = proto.Unmarshal(body, req); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	views, err := group.GetMultiContext(r.Context(), req.Keys)
+	errs, _ := err.(MultiError)
+	res := &pb.MultiResponse{}
+	for _, key := range req.Keys {
+		if view, ok := views[key]; ok {
+			res.Items = append(res.Items, &pb.Item{Key: key, Value: view.b, Expire: unixNano(view.Expire()), Codec: codecName(view.c)})
+		} else if err, ok := errs[key]; ok && errors.Is(err, ErrNotFound) {
+			res.Items = append(res.Items, &pb.Item{Key: key, NotFound: true})
+		} else if ok {
+			res.Items = append(res.Items, &pb.Item{Key: key, Error: err.Error()})
+		}
+	}
+	body, err = proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+// 其他节点写入的值，由本机(key的所属节点)保存
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.SetRequest{}
+	if err = proto.Unmarshal(body, req); err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	c, err := codecByName(req.Codec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.populateCache(key, ByteView{b: req.Value, e: fromUnixNano(req.Expire), c: c})
+}
+
 // 客户端
 type httpGetter struct {
-	baseURL string
+	baseURL   string
+	client    *http.Client
+	backoff   time.Duration //请求失败后不可用的时间
+	failUntil int64         //在此时间(UnixNano)之前视为不可用
+	secret    []byte        //不为空时对请求签名
+	self      string        //本机地址，作为请求的caller
 }
 
-// 获取value
-func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(in.GetGroup()), url.QueryEscape(in.GetKey()))
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	return &httpGetter{
+		baseURL: peer + p.basePath, //baseURL="http://localhost:9999" + "/_geecache/"
+		client:  p.client,
+		backoff: p.opts.FailureBackoff,
+		secret:  p.opts.Secret,
+		self:    p.self,
+	}
+}
+
+func (h *httpGetter) healthy() bool {
+	return time.Now().UnixNano() >= atomic.LoadInt64(&h.failUntil)
+}
+
+// 发送请求，网络错误时将节点标记为不可用(调用方主动取消的除外)
+func (h *httpGetter) send(req *http.Request) (*http.Response, error) {
+	if len(h.secret) > 0 {
+		if err := signRequest(req, h.secret); err != nil {
+			return nil, err
+		}
+	}
+	res, err := h.client.Do(req)
+	if err != nil && req.Context().Err() == nil && h.backoff > 0 {
+		atomic.StoreInt64(&h.failUntil, time.Now().Add(h.backoff).UnixNano())
+	}
+	return res, err
+}
+
+func (h *httpGetter) url(group, key string) string {
 	//"http://localhost:9999/_geecache/soures/Tom"
-	res, err := http.Get(u)
+	return fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(group), url.QueryEscape(key))
+}
+
+// 获取value
+func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url(in.GetGroup(), in.GetKey()), nil)
+	if err != nil {
+		return err
+	}
+	if in.Caller == "" {
+		in.Caller = h.self
+	}
+	setTraceHeader(req.Header, in)
+	res, err := h.send(req)
 	if err != nil {
 		return err
 	}
@@ -105,28 +337,258 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	return nil
 }
 
+// 写入value
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, h.url(in.GetGroup(), in.GetKey()), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return h.do(req)
+}
+
+// 批量获取value，一次请求发送所有key
+func (h *httpGetter) GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error {
+	if in.Caller == "" {
+		in.Caller = h.self
+	}
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	u := h.baseURL + url.QueryEscape(in.GetGroup())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	setTraceHeader(req.Header, in)
+	res, err := h.send(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %v", err)
+	}
+	if err = proto.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	return nil
+}
+
+// 删除对方节点上的本地缓存
+func (h *httpGetter) Remove(ctx context.Context, in *pb.Request) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, h.url(in.GetGroup(), in.GetKey()), nil)
+	if err != nil {
+		return err
+	}
+	return h.do(req)
+}
+
+// 删除对方节点上所有以in.Key开头的本地缓存
+func (h *httpGetter) RemovePrefix(ctx context.Context, in *pb.Request) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, h.url(in.GetGroup(), in.GetKey())+"?prefix=1", nil)
+	if err != nil {
+		return err
+	}
+	return h.do(req)
+}
+
+func (h *httpGetter) do(req *http.Request) error {
+	res, err := h.send(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
 // 实例化一致性哈希算法，并添加了节点
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...) //添加节点
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	p.peers = nil
+	p.addPeers(peers...)
+}
+
+// 增量添加节点，已有节点在环上的位置不变
+func (p *HTTPPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addPeers(peers...)
+}
+
+// 添加带权重的节点，权重越大分到的key越多，适用于内存大小不同的节点
+func (p *HTTPPool) AddWeightedPeer(peer string, weight int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lazyInit()
+	p.peers.AddWeighted(peer, weight)
+	if _, ok := p.httpGetters[peer]; !ok {
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+}
+
+// 增量删除节点
+func (p *HTTPPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removePeers(peers...)
+}
+
+func (p *HTTPPool) lazyInit() {
+	if p.peers == nil {
+		p.peers = p.opts.NewPicker()
+		p.httpGetters = make(map[string]*httpGetter)
+	}
+}
+
+func (p *HTTPPool) addPeers(peers ...string) {
+	p.lazyInit()
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		p.peers.Add(peer) //添加节点
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+}
+
+func (p *HTTPPool) removePeers(peers ...string) {
+	if p.peers == nil {
+		return
+	}
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{
-			baseURL: peer + p.basePath,
-		} //baseURL="http://localhost:9999" + "/_geecache/"
+		if _, ok := p.httpGetters[peer]; !ok {
+			continue
+		}
+		p.peers.Remove(peer)
+		delete(p.httpGetters, peer)
+	}
+}
+
+// 将节点列表同步为peers，只增删有变化的节点
+func (p *HTTPPool) syncPeers(peers []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	alive := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		alive[peer] = true
+	}
+	var removed []string
+	for peer := range p.httpGetters {
+		if !alive[peer] {
+			removed = append(removed, peer)
+		}
+	}
+	if len(removed) > 0 {
+		p.Log("remove peers %v", removed)
+		p.removePeers(removed...)
+	}
+	p.addPeers(peers...)
+}
+
+// 通过注册中心加入集群：定期发送心跳，并按interval从注册中心同步节点列表
+// 返回的leave停止心跳与同步，并从注册中心注销本机，节点退出前调用
+func (p *HTTPPool) Join(registryAddr string, interval time.Duration) (leave func()) {
+	if interval == 0 {
+		interval = defaultSyncInterval
+	}
+	stopHeartbeat := registry.Heartbeat(registryAddr, p.self, 0)
+	update := func() {
+		peers, err := registry.Servers(registryAddr)
+		if err != nil {
+			p.Log("sync peers from registry: %v", err)
+			return
+		}
+		p.syncPeers(peers)
+	}
+	update()
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				update()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			stopHeartbeat()
+		})
 	}
 }
 
 // 包装一致性哈希的Get方法，获取服务器节点
+// 所属节点不可用时，返回下一个可用的副本节点
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+	peers, pos := p.PickReplicas(key)
+	if pos == 0 || len(peers) == 0 {
+		return nil, false
+	}
+	return peers[0], true
+}
+
+// 返回key在环上连续Replication个节点中可用的那些，不含本机
+func (p *HTTPPool) PickReplicas(key string) ([]PeerGetter, int) {
+	peers, pos := p.pickReplicas(key, true)
+	if len(peers) > 0 && pos != 0 {
+		p.Log("Pick peer %s", peers[0].(*httpGetter).baseURL)
+	}
+	return peers, pos
+}
+
+// 返回key在环上连续Replication个节点，包括暂时不可用的节点，不含本机
+func (p *HTTPPool) AllReplicas(key string) ([]PeerGetter, int) {
+	return p.pickReplicas(key, false)
+}
+
+func (p *HTTPPool) pickReplicas(key string, healthyOnly bool) ([]PeerGetter, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, 0
+	}
+	var peers []PeerGetter
+	pos := -1
+	for _, node := range p.peers.GetN(key, p.opts.Replication) {
+		if node == p.self {
+			pos = len(peers)
+			continue
+		}
+		if getter := p.httpGetters[node]; !healthyOnly || getter.healthy() {
+			peers = append(peers, getter)
+		}
+	}
+	return peers, pos
+}
+
+// 返回除自己以外的所有节点
+func (p *HTTPPool) GetAll() []PeerGetter {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+	var all []PeerGetter
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			all = append(all, getter)
+		}
 	}
-	
-return nil, false
-}
\ No newline at end of file
+	return all
+}
@@ -0,0 +1,201 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"geecache/registry"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAddRemovePeers(t *testing.T) {
+	p := NewHTTPPool("http://localhost:8001")
+	p.AddPeers("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+	owners := make(map[string]string)
+	for _, key := range []string{"Tom", "Jack", "Sam", "Alice", "Bob"} {
+		owners[key] = p.peers.Get(key)
+	}
+
+	p.RemovePeers("http://localhost:8003")
+	if len(p.GetAll()) != 1 {
+		t.Fatalf("expect 1 peer left besides self, got %d", len(p.GetAll()))
+	}
+	for key, owner := range owners {
+		if owner != "http://localhost:8003" && p.peers.Get(key) != owner {
+			t.Fatalf("key %s should stay on %s after removing another peer", key, owner)
+		}
+	}
+
+	p.AddPeers("http://localhost:8003")
+	for key, owner := range owners {
+		if p.peers.Get(key) != owner {
+			t.Fatalf("key %s should move back to %s", key, owner)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	reg := httptest.NewServer(registry.New(time.Minute))
+	defer reg.Close()
+	a := NewHTTPPool("http://localhost:8001")
+	b := NewHTTPPool("http://localhost:8002")
+	a.Join(reg.URL, time.Hour)
+	leave := b.Join(reg.URL, time.Hour)
+	//a加入时b还没有注册，模拟a的下一次同步
+	peers, err := registry.Servers(reg.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.syncPeers(peers)
+
+	if len(a.GetAll()) != 1 || len(b.GetAll()) != 1 {
+		t.Fatalf("both nodes should find each other, got %d and %d", len(a.GetAll()), len(b.GetAll()))
+	}
+
+	//b退出时从注册中心注销
+	leave()
+	leave()
+	if peers, err = registry.Servers(reg.URL); err != nil || len(peers) != 1 || peers[0] != "http://localhost:8001" {
+		t.Fatalf("b should be deregistered, got %v, %v", peers, err)
+	}
+}
+
+func TestWeightedPeers(t *testing.T) {
+	p := NewHTTPPoolOpts("http://localhost:8001", &HTTPPoolOptions{
+		NewPicker: func() consistenthash.Picker { return consistenthash.NewRendezvous(nil) },
+	})
+	p.AddPeers("http://localhost:8001")
+	p.AddWeightedPeer("http://localhost:8002", 3)
+	remote := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := p.PickPeer(strconv.Itoa(i)); ok {
+			remote++
+		}
+	}
+	if remote < 650 || remote > 850 {
+		t.Fatalf("peer with weight 3 should own about 3/4 of keys, got %d/1000", remote)
+	}
+}
+
+func TestPeerTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	p := NewHTTPPoolOpts("http://localhost:8001", &HTTPPoolOptions{Timeout: time.Minute})
+	getter := p.newGetter(slow.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := getter.Get(ctx, &pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+	if err == nil || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("peer request should stop at ctx deadline, got %v after %v", err, time.Since(start))
+	}
+
+	p = NewHTTPPoolOpts("http://localhost:8001", &HTTPPoolOptions{Timeout: 20 * time.Millisecond})
+	start = time.Now()
+	err = p.newGetter(slow.URL).Get(context.Background(), &pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+	if err == nil || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("peer request should stop at pool timeout, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestPickReplicas(t *testing.T) {
+	alive := httptest.NewServer(http.NotFoundHandler())
+	defer alive.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	p := NewHTTPPoolOpts("http://localhost:8001", &HTTPPoolOptions{Replication: 3})
+	p.AddPeers("http://localhost:8001", alive.URL, dead.URL)
+
+	key := ""
+	for i := 0; key == ""; i++ {
+		if peers, _ := p.PickReplicas(strconv.Itoa(i)); len(peers) == 2 {
+			key = strconv.Itoa(i)
+		}
+	}
+	peers, pos := p.PickReplicas(key)
+	if pos < 0 || pos > 2 {
+		t.Fatalf("self should be one of 3 replicas, got pos %d", pos)
+	}
+	//连接失败后，该节点在一段时间内被跳过
+	for _, peer := range peers {
+		peer.Get(context.Background(), &pb.Request{Group: "scores", Key: key}, &pb.Response{})
+	}
+	if peers, _ = p.PickReplicas(key); len(peers) != 1 || peers[0].(*httpGetter).baseURL != alive.URL+defaultBasePath {
+		t.Fatalf("dead peer should be skipped, got %d peers", len(peers))
+	}
+	//写入与删除仍要发给不可用的节点
+	if peers, _ = p.AllReplicas(key); len(peers) != 2 {
+		t.Fatalf("AllReplicas should include the dead peer, got %d peers", len(peers))
+	}
+}
+
+func TestHTTPNotFound(t *testing.T) {
+	NewGroup("httpnotfound", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return nil, ErrNotFound }))
+	p := NewHTTPPool("http://localhost:8001")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	res := &pb.Response{}
+	err := p.newGetter(srv.URL).Get(context.Background(), &pb.Request{Group: "httpnotfound", Key: "Tom"}, res)
+	if err != nil || !res.NotFound {
+		t.Fatalf("expect typed not found response, got %v, %v", res, err)
+	}
+	multi := &pb.MultiResponse{}
+	err = p.newGetter(srv.URL).GetMulti(context.Background(), &pb.MultiRequest{Group: "httpnotfound", Keys: []string{"Tom"}}, multi)
+	if err != nil || len(multi.Items) != 1 || !multi.Items[0].NotFound {
+		t.Fatalf("expect typed not found item, got %v, %v", multi, err)
+	}
+}
+
+func TestHTTPRemovePrefix(t *testing.T) {
+	gee := NewGroup("httpremoveprefix", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	p := NewHTTPPool("http://localhost:8001")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	gee.Get("a/1")
+	gee.Get("a/2")
+	gee.Get("b/1")
+	err := p.newGetter(srv.URL).RemovePrefix(context.Background(), &pb.Request{Group: "httpremoveprefix", Key: "a/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := gee.Keys(""); len(keys) != 1 || keys[0] != "b/1" {
+		t.Fatalf("expect only b/1 left, got %v", keys)
+	}
+}
+
+func TestHTTPGetMulti(t *testing.T) {
+	NewGroup("httpmulti", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	p := NewHTTPPool("http://localhost:8001")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	res := &pb.MultiResponse{}
+	req := &pb.MultiRequest{Group: "httpmulti", Keys: []string{"Tom", "unknown"}}
+	if err := p.newGetter(srv.URL).GetMulti(context.Background(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Items) != 2 || string(res.Items[0].Value) != "630" || res.Items[1].Error == "" {
+		t.Fatalf("unexpected response %v", res.Items)
+	}
+}
@@ -0,0 +1,190 @@
+package lfu
+
+import (
+	"container/list"
+	"geecache/lru"
+	"sort"
+	"time"
+)
+
+// Value 与lru.Value相同，便于各淘汰策略互换
+type Value = lru.Value
+
+// 最不经常使用(LFU)淘汰策略
+// 相同访问次数的条目按LRU顺序淘汰
+type Cache struct {
+	maxBytes  int64                    //最大内存
+	nbytes    int64                    //当前已使用的内存
+	cache     map[string]*list.Element //key -> 所在频率链表中的节点
+	freqs     map[int]*list.List       //访问次数 -> 链表(越靠前越新)
+	minFreq   int                      //当前最小的访问次数
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time
+	freq   int
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+// new a instance
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		freqs:     make(map[int]*list.List),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 命中时访问次数加一
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if kv.expired(time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.touch(ele)
+		return kv.value, true
+	}
+	return
+}
+
+// add or modify
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.expire = expire
+		c.touch(ele)
+	} else {
+		kv := &entry{key: key, value: value, expire: expire, freq: 1}
+		c.cache[key] = c.list(1).PushFront(kv)
+		c.minFreq = 1
+		c.nbytes += kv.size()
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// 淘汰访问次数最少的条目中最久未使用的一个
+func (c *Cache) RemoveOldest() {
+	if len(c.cache) == 0 {
+		return
+	}
+	l, ok := c.freqs[c.minFreq]
+	if !ok {
+		c.resetMinFreq()
+		l = c.freqs[c.minFreq]
+	}
+	c.removeElement(l.Back())
+}
+
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+func (c *Cache) RemoveExpired() {
+	now := time.Now()
+	for _, ele := range c.cache {
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// 当前已使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// 按访问次数从少到多、同一次数内从旧到新的顺序遍历，f返回false时停止
+func (c *Cache) Range(f func(key string, value Value, expire time.Time) bool) {
+	freqs := make([]int, 0, len(c.freqs))
+	for freq := range c.freqs {
+		freqs = append(freqs, freq)
+	}
+	sort.Ints(freqs)
+	for _, freq := range freqs {
+		if !rangeList(c.freqs[freq], f) {
+			return
+		}
+	}
+}
+
+func rangeList(l *list.List, f func(key string, value Value, expire time.Time) bool) bool {
+	for ele := l.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !f(kv.key, kv.value, kv.expire) {
+			return false
+		}
+	}
+	return true
+}
+
+// 将条目移动到下一个访问次数的链表
+func (c *Cache) touch(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.unlink(ele)
+	if kv.freq == c.minFreq && c.freqs[kv.freq] == nil {
+		c.minFreq++
+	}
+	kv.freq++
+	c.cache[kv.key] = c.list(kv.freq).PushFront(kv)
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.unlink(ele)
+	delete(c.cache, kv.key)
+	c.nbytes -= kv.size()
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// 从所在链表中摘除，链表为空时一并删除
+func (c *Cache) unlink(ele *list.Element) {
+	freq := ele.Value.(*entry).freq
+	l := c.freqs[freq]
+	l.Remove(ele)
+	if l.Len() == 0 {
+		delete(c.freqs, freq)
+	}
+}
+
+func (c *Cache) list(freq int) *list.List {
+	l, ok := c.freqs[freq]
+	if !ok {
+		l = list.New()
+		c.freqs[freq] = l
+	}
+	return l
+}
+
+func (c *Cache) resetMinFreq() {
+	c.minFreq = 0
+	for freq := range c.freqs {
+		if c.minFreq == 0 || freq < c.minFreq {
+			c.minFreq = freq
+		}
+	}
+}
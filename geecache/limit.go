@@ -0,0 +1,117 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 加载被拒绝的原因，通过errors.Is判断
+var (
+	ErrLoadQueueFull = errors.New("geecache: load queue is full")
+	ErrLoadTimeout   = errors.New("geecache: timed out waiting for a load slot")
+	ErrRateLimited   = errors.New("geecache: load rate limit exceeded")
+)
+
+// LimitError 数据源加载被并发限制或速率限制拒绝，Err为上面的原因之一
+type LimitError struct {
+	Group string
+	Key   string
+	Err   error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v (group %s, key %s)", e.Err, e.Group, e.Key)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// 限制同时进行的数据源加载数，以及每秒加载的次数
+// 零值表示不限制
+type loadLimiter struct {
+	sem      chan struct{} //容量为最大并发数，为nil时不限制
+	maxQueue int64         //等待空位的最大数量
+	timeout  time.Duration //等待空位的最长时间，不大于0时只受ctx限制
+	waiting  int64         //正在等待的数量，原子读写
+	bucket   *tokenBucket  //为nil时不限制速率
+}
+
+// 获取一个加载名额，返回后需要调用release
+func (g *Group) acquireLoad(ctx context.Context, key string) (release func(), err error) {
+	l := &g.limiter
+	if l.bucket != nil && !l.bucket.allow() {
+		g.stats.LoadsRejected.Add(1)
+		return nil, &LimitError{Group: g.name, Key: key, Err: ErrRateLimited}
+	}
+	if l.sem == nil {
+		return func() {}, nil
+	}
+	release = func() { <-l.sem }
+	select {
+	case l.sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	//没有空位，排队等待
+	if atomic.AddInt64(&l.waiting, 1) > l.maxQueue {
+		atomic.AddInt64(&l.waiting, -1)
+		g.stats.LoadsRejected.Add(1)
+		return nil, &LimitError{Group: g.name, Key: key, Err: ErrLoadQueueFull}
+	}
+	defer atomic.AddInt64(&l.waiting, -1)
+	g.stats.LoadsQueued.Add(1)
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		t := time.NewTimer(l.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return release, nil
+	case <-timeout:
+		g.stats.LoadsRejected.Add(1)
+		return nil, &LimitError{Group: g.name, Key: key, Err: ErrLoadTimeout}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// 令牌桶，每秒补充rate个令牌，最多积累burst个
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// 取走一个令牌，没有令牌时返回false
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,76 @@
+package geecache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadLimit(t *testing.T) {
+	block := make(chan struct{})
+	gee := NewGroup("loadlimit", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				<-block
+			}
+			return []byte(key), nil
+		}), WithLoadLimit(1, 1, 50*time.Millisecond))
+
+	done := make(chan error)
+	go func() {
+		_, err := gee.Get("slow")
+		done <- err
+	}()
+	for len(gee.limiter.sem) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	queued := make(chan error)
+	go func() {
+		_, err := gee.Get("queued")
+		queued <- err
+	}()
+	for atomic.LoadInt64(&gee.limiter.waiting) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	//并发数与队列都已满
+	_, err := gee.Get("rejected")
+	var le *LimitError
+	if !errors.As(err, &le) || !errors.Is(err, ErrLoadQueueFull) || le.Key != "rejected" {
+		t.Fatalf("expect queue full error, got %v", err)
+	}
+	if err = <-queued; !errors.Is(err, ErrLoadTimeout) {
+		t.Fatalf("expect queue timeout, got %v", err)
+	}
+	close(block)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = gee.Get("after"); err != nil {
+		t.Fatalf("slot should be released, got %v", err)
+	}
+	if s := gee.Stats(); s.LoadsQueued != 1 || s.LoadsRejected != 2 || s.LoadsInFlight != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	gee := NewGroup("ratelimit", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }), WithRateLimit(1, 2))
+	for _, key := range []string{"k1", "k2"} {
+		if _, err := gee.Get(key); err != nil {
+			t.Fatalf("burst should be allowed, got %v", err)
+		}
+	}
+	if _, err := gee.Get("k3"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expect rate limited error, got %v", err)
+	}
+	//缓存命中不消耗令牌
+	if _, err := gee.Get("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if s := gee.Stats(); s.LoadsRejected != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
@@ -1,6 +1,9 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 type Cache struct {
 	maxBytes   int64      //最大内存
@@ -12,8 +15,14 @@ type Cache struct {
 
 // 双向循环链表的节点数据类型
 type entry struct {
-	key   string
-	value Value
+	key    string
+	value  Value
+	expire time.Time //过期时间，零值表示永不过期
+}
+
+// 判断条目在now时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
 }
 
 type Value interface {
@@ -32,11 +41,16 @@ func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
 
 // search
 // 1.找到对应的节点
-// 2.将该节点移动到队尾
+// 2.已过期则惰性删除，返回未命中
+// 3.将该节点移动到队尾
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.catche[key]; ok {
-		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		if kv.expired(time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele)
 		return kv.value, true
 	}
 	return
@@ -46,27 +60,103 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
+		c.removeElement(ele)
+	}
+
+}
+
+// 删除指定的条目
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.catche[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// 查找条目，但不更新其位置，已过期时返回未命中
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	if ele, ok := c.catche[key]; ok {
 		kv := ele.Value.(*entry)
-		delete(c.catche, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OneEvicted != nil {
-			c.OneEvicted(kv.key, kv.value)
+		if !kv.expired(time.Now()) {
+			return kv.value, true
+		}
+	}
+	return
+}
+
+// 判断是否存在未过期的条目，不更新其位置
+func (c *Cache) Contains(key string) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
+
+// 按从旧到新的顺序返回所有未过期条目的key
+func (c *Cache) Keys() []string {
+	now := time.Now()
+	keys := make([]string, 0, c.ll.Len())
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		if kv := ele.Value.(*entry); !kv.expired(now) {
+			keys = append(keys, kv.key)
+		}
+	}
+	return keys
+}
+
+// 修改最大内存，超出时淘汰最旧的条目，返回淘汰的条目数
+func (c *Cache) Resize(maxBytes int64) int {
+	c.maxBytes = maxBytes
+	n := 0
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+		n++
+	}
+	return n
+}
+
+// 删除所有条目，每个条目都会触发OneEvicted
+func (c *Cache) Purge() {
+	for ele := c.ll.Back(); ele != nil; ele = c.ll.Back() {
+		c.removeElement(ele)
+	}
+}
+
+// 删除所有已过期的条目，供后台定期清理使用
+func (c *Cache) RemoveExpired() {
+	now := time.Now()
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
 		}
+		ele = prev
 	}
+}
 
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.catche, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OneEvicted != nil {
+		c.OneEvicted(kv.key, kv.value)
+	}
 }
 
 // add or modify
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// 添加或修改条目，并设置过期时间(零值表示永不过期)
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
 	//如果该缓存已存在，就进行修改
 	if ele, ok := c.catche[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else { //如果不存在就添加该缓存
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry{key, value, expire})
 		c.catche[key] = ele
 		c.nbytes += int64(len(key)) + int64(value.Len())
 	}
@@ -80,3 +170,19 @@ func (c *Cache) Add(key string, value Value) {
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// 当前已使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// 按从旧到新的顺序遍历所有条目(包括已过期但还未删除的)，f返回false时停止
+// 遍历期间不能修改缓存
+func (c *Cache) Range(f func(key string, value Value, expire time.Time) bool) {
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !f(kv.key, kv.value, kv.expire) {
+			return
+		}
+	}
+}
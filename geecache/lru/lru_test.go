@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -63,3 +64,49 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lru.nbytes)
 	}
 }
+
+func TestExpire(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lru.AddWithExpire("key2", String("1234"), time.Now().Add(time.Hour))
+	lru.AddWithExpire("key3", String("1234"), time.Now().Add(-time.Second))
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 2 {
+		t.Fatalf("expired key1 should be removed on Get")
+	}
+	lru.RemoveExpired()
+	if _, ok := lru.Get("key2"); !ok || lru.Len() != 1 {
+		t.Fatalf("RemoveExpired should only remove key3")
+	}
+}
+
+func TestPeekContainsKeys(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.AddWithExpire("k3", String("3"), time.Now().Add(-time.Second))
+	if v, ok := lru.Peek("k1"); !ok || string(v.(String)) != "1" {
+		t.Fatalf("Peek k1 failed")
+	}
+	//Peek不更新位置，k1仍然是最旧的
+	if keys := lru.Keys(); !reflect.DeepEqual(keys, []string{"k1", "k2"}) {
+		t.Fatalf("Keys should skip expired entries and keep order, got %v", keys)
+	}
+	if lru.Contains("k3") || !lru.Contains("k2") {
+		t.Fatalf("Contains should ignore expired entries")
+	}
+}
+
+func TestResizePurge(t *testing.T) {
+	evicted := 0
+	lru := New(int64(0), func(string, Value) { evicted++ })
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Add("k3", String("3"))
+	if n := lru.Resize(4); n != 2 || lru.Len() != 1 || !lru.Contains("k3") {
+		t.Fatalf("Resize should evict the oldest entries, evicted %d", n)
+	}
+	lru.Purge()
+	if lru.Len() != 0 || lru.Bytes() != 0 || evicted != 3 {
+		t.Fatalf("Purge should remove all entries")
+	}
+}
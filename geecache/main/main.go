@@ -4,8 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"geecache"
+	"geecache/registry"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var db = map[string]string{
@@ -15,8 +20,12 @@ var db = map[string]string{
 }
 
 
-//创建一个实例节点
-func createGroup() *geecache.Group {
+//创建一个实例节点，snapshotDir不为空时启动时恢复快照并定期保存
+func createGroup(snapshotDir string) *geecache.Group {
+	var opts []geecache.GroupOption
+	if snapshotDir != "" {
+		opts = append(opts, geecache.WithSnapshot(snapshotDir, time.Minute))
+	}
 	return geecache.NewGroup("scores", 2<<10, geecache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
@@ -24,13 +33,31 @@ func createGroup() *geecache.Group {
 				return []byte(v), nil
 			}
 			return nil, fmt.Errorf("%s not exist", key)
-		}))
+		}), opts...)
 }
 
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+// registryURL不为空时通过注册中心发现其他节点，否则使用固定的节点列表
+// secret不为空时节点间的请求需要签名
+func startCacheServer(addr string, addrs []string, gee *geecache.Group, registryURL, secret string) {
+	peers := geecache.NewHTTPPoolOpts(addr, &geecache.HTTPPoolOptions{Secret: []byte(secret)})
+	leave := func() {}
+	if registryURL != "" {
+		leave = peers.Join(registryURL, 0)
+	} else {
+		peers.Set(addrs...)
+	}
 	gee.RegisterPeers(peers)
+	//退出时从注册中心注销，并保存最后一次快照
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		leave()
+		if err := gee.Close(); err != nil {
+			log.Println("close group:", err)
+		}
+		os.Exit(0)
+	}()
 	log.Println("geecache is running at", addr)
 	log.Fatal(http.ListenAndServe(addr[7:], peers))
 }
@@ -53,14 +80,26 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 
 }
 
+// 启动节点注册中心
+func startRegistryServer(addr string) {
+	log.Println("registry is running at", addr)
+	log.Fatal(http.ListenAndServe(addr[7:], registry.DefaultGeeRegister))
+}
+
 func main() {
 	var port int
-	var api bool
+	var api, reg, discover bool
+	var snapshotDir, secret string
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.BoolVar(&reg, "registry", false, "Start a registry server?")
+	flag.BoolVar(&discover, "discover", false, "Find peers through the registry?")
+	flag.StringVar(&snapshotDir, "snapshot", "", "Directory to save and restore cache snapshots")
+	flag.StringVar(&secret, "secret", "", "Shared secret to authenticate requests between peers")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
+	registryAddr := "http://localhost:9998"
 	addrMap := map[int]string{
 		8001: "http://localhost:8001",
 		8002: "http://localhost:8002",
@@ -72,9 +111,16 @@ func main() {
 		addrs = append(addrs, v)
 	}
 
-	gee := createGroup()
+	gee := createGroup(snapshotDir)
+	if reg {
+		go startRegistryServer(registryAddr)
+	}
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
-	startCacheServer(addrMap[port], []string(addrs), gee)
+	registryURL := ""
+	if discover {
+		registryURL = registryAddr + "/_geecache_/registry"
+	}
+	startCacheServer(addrMap[port], []string(addrs), gee, registryURL, secret)
 }
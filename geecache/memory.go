@@ -0,0 +1,201 @@
+package geecache
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWeight   = 1           //group的默认权重
+	hitRateHalfLife = time.Minute //命中数衰减一半的时间
+)
+
+// 进程内所有group共享的内存上限
+var arbiter struct {
+	mu      sync.Mutex //同一时间只有一个goroutine执行淘汰
+	limit   int64      //原子读写，0表示不限制
+	pending int32      //原子读写，有新的写入需要检查上限
+	used    int64      //原子读写，所有group已使用的内存，未超出上限时不必遍历group
+}
+
+// 设置所有group共享的内存上限，0表示不限制
+// 超出上限时，从边际价值最低的group中淘汰最旧的条目；
+// 与NewGroup的cacheBytes同时生效，只使用全局上限时cacheBytes可以为0
+func SetMemoryLimit(bytes int64) {
+	atomic.StoreInt64(&arbiter.limit, bytes)
+	enforceMemoryLimit()
+}
+
+// Allocation 某个group当前的内存分配
+type Allocation struct {
+	Weight float64 `json:"weight"`
+	Bytes  int64   `json:"bytes"` //当前使用的内存
+	Share  int64   `json:"share"` //按权重应得的份额，未设置上限时为0
+	Value  float64 `json:"value"` //每字节内存的价值，超出上限时先淘汰该值最低的group
+}
+
+// 返回每个group当前的内存分配
+func Allocations() map[string]Allocation {
+	gs := allGroups()
+	res := make(map[string]Allocation, len(gs))
+	for _, g := range gs {
+		res[g.name] = g.allocationIn(gs)
+	}
+	return res
+}
+
+// 当前group的内存分配，不能在持有mu时调用
+func (g *Group) allocation() Allocation {
+	return g.allocationIn(allGroups())
+}
+
+func (g *Group) allocationIn(gs []*Group) Allocation {
+	a := Allocation{Weight: g.weight, Bytes: g.usedBytes(), Value: g.marginalValue()}
+	limit := atomic.LoadInt64(&arbiter.limit)
+	var weights float64
+	for _, other := range gs {
+		weights += other.weight
+	}
+	if limit > 0 && weights > 0 {
+		a.Share = int64(float64(limit) * g.weight / weights)
+	}
+	return a
+}
+
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	return gs
+}
+
+// 所有cache已使用的内存
+func (g *Group) usedBytes() int64 {
+	return g.mainCache.bytes() + g.hotCache.bytes() + g.negCache.bytes()
+}
+
+// 被替换的group不再参与淘汰，它使用的内存也不再计入arbiter.used
+func (g *Group) untrack() {
+	g.mainCache.untrack()
+	g.hotCache.untrack()
+	g.negCache.untrack()
+}
+
+func (g *Group) totalHits() int64 {
+	return g.stats.CacheHits.Get() + g.stats.NegativeHits.Get()
+}
+
+// 当前的边际价值，不修改衰减状态
+func (g *Group) marginalValue() float64 {
+	return g.valueOf(g.hitRate.peek(g.totalHits(), time.Now()), g.usedBytes())
+}
+
+// 用平均每字节带来的近期命中次数乘以权重，估计再淘汰一个条目的代价
+// 没有使用内存的group不参与淘汰
+func (g *Group) valueOf(hits float64, used int64) float64 {
+	if used <= 0 {
+		return 0
+	}
+	return g.weight * (hits + 1) / float64(used)
+}
+
+// 命中数的指数衰减累计，每过hitRateHalfLife，之前的命中数减半，
+// 很久以前的命中不会一直保护一个已经不再使用的group
+type hitRate struct {
+	mu    sync.Mutex
+	total int64     //上次更新时的累计命中数
+	at    time.Time //上次更新的时间
+	value float64
+}
+
+// 根据当前的累计命中数更新并返回衰减后的命中数
+func (r *hitRate) update(total int64, now time.Time) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.value = r.decayed(total, now)
+	r.total, r.at = total, now
+	return r.value
+}
+
+// 返回衰减后的命中数，不修改状态
+func (r *hitRate) peek(total int64, now time.Time) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.decayed(total, now)
+}
+
+// 上次更新之后的命中不知道具体时间，按均匀分布在这段时间内计算衰减，
+// 结果与更新的频率基本无关，需持有mu
+func (r *hitRate) decayed(total int64, now time.Time) float64 {
+	hits := float64(total - r.total)
+	x := float64(now.Sub(r.at)) / float64(hitRateHalfLife)
+	if r.at.IsZero() || x <= 0 {
+		return r.value + hits
+	}
+	decay := math.Exp2(-x)
+	return r.value*decay + hits*(1-decay)/(x*math.Ln2)
+}
+
+// 淘汰一个条目，依次尝试hotCache、negCache、mainCache，
+// 前两者只是加速，丢失的代价比mainCache小
+func (g *Group) evictOne() bool {
+	for _, c := range []*cache{&g.hotCache, &g.negCache, &g.mainCache} {
+		if c.bytes() > 0 && c.removeOldest() {
+			return true
+		}
+	}
+	return false
+}
+
+// 所有group使用的内存超出上限时，反复从价值最低的group中淘汰条目
+// 已有goroutine在淘汰时不等待，由它在结束后重新检查
+func enforceMemoryLimit() {
+	for {
+		limit := atomic.LoadInt64(&arbiter.limit)
+		if limit <= 0 || atomic.LoadInt64(&arbiter.used) <= limit {
+			return
+		}
+		atomic.StoreInt32(&arbiter.pending, 1)
+		if !arbiter.mu.TryLock() {
+			return
+		}
+		atomic.StoreInt32(&arbiter.pending, 0)
+		evictOverLimit(limit)
+		arbiter.mu.Unlock()
+		//淘汰期间有新的写入，它的检查可能已经错过，需要再检查一次
+		if atomic.LoadInt32(&arbiter.pending) == 0 {
+			return
+		}
+	}
+}
+
+// 每次淘汰开始时推进一次各group的衰减状态，淘汰过程中命中数不变，
+// 只有使用的内存随淘汰变化，需持有arbiter.mu
+func evictOverLimit(limit int64) {
+	gs := allGroups()
+	now := time.Now()
+	hits := make([]float64, len(gs))
+	for i, g := range gs {
+		hits[i] = g.hitRate.update(g.totalHits(), now)
+	}
+	for atomic.LoadInt64(&arbiter.used) > limit {
+		victim, lowest := -1, 0.0
+		for i, g := range gs {
+			used := g.usedBytes()
+			if used <= 0 {
+				continue
+			}
+			if v := g.valueOf(hits[i], used); victim < 0 || v < lowest {
+				victim, lowest = i, v
+			}
+		}
+		if victim < 0 || !gs[victim].evictOne() {
+			return
+		}
+	}
+}
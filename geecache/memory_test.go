@@ -0,0 +1,98 @@
+package geecache
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimit(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strings.Repeat("v", 100)), nil
+	})
+	low := NewGroup("memory-low", 0, getter)
+	high := NewGroup("memory-high", 0, getter, WithWeight(4))
+	for i := 0; i < 100; i++ {
+		for _, g := range []*Group{low, high} {
+			key := fmt.Sprintf("k%03d", i)
+			g.Get(key)
+			g.Get(key)
+		}
+	}
+
+	const limit = 10000
+	SetMemoryLimit(limit)
+	defer SetMemoryLimit(0)
+
+	var total int64
+	allocs := Allocations()
+	for _, a := range allocs {
+		total += a.Bytes
+	}
+	if total > limit {
+		t.Fatalf("total memory %d should not exceed limit %d", total, limit)
+	}
+	l, h := allocs["memory-low"], allocs["memory-high"]
+	if h.Bytes < 3*l.Bytes || l.Bytes == 0 {
+		t.Fatalf("group with weight 4 should keep about 4x memory, got %d vs %d", h.Bytes, l.Bytes)
+	}
+	if h.Share <= l.Share || high.Stats().Memory.Bytes != h.Bytes {
+		t.Fatalf("unexpected allocation %+v", h)
+	}
+
+	//继续写入时仍然受上限约束
+	for i := 100; i < 200; i++ {
+		low.Get(fmt.Sprintf("k%03d", i))
+	}
+	if used := low.usedBytes() + high.usedBytes(); used > limit {
+		t.Fatalf("memory should stay under limit, got %d", used)
+	}
+}
+
+func TestHitRateDecay(t *testing.T) {
+	var r hitRate
+	now := time.Now()
+	r.update(100, now)
+	//一个半衰期后，之前的命中减半，新的命中按均匀分布衰减
+	want := 50 + 5/math.Ln2
+	if v := r.peek(110, now.Add(hitRateHalfLife)); math.Abs(v-want) > 1e-9 {
+		t.Fatalf("expect %v decayed hits, got %v", want, v)
+	}
+	//peek不修改状态，多次读取与更新的结果相同
+	r.peek(110, now.Add(hitRateHalfLife/2))
+	if v := r.update(110, now.Add(hitRateHalfLife)); math.Abs(v-want) > 1e-9 {
+		t.Fatalf("peek should not change the state, got %v", v)
+	}
+	//很久没有命中时趋近于0
+	if v := r.update(110, now.Add(20*hitRateHalfLife)); v > 0.01 {
+		t.Fatalf("old hits should decay away, got %v", v)
+	}
+}
+
+func TestMemoryUsed(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	sum := func() int64 {
+		var total int64
+		for _, g := range allGroups() {
+			total += g.usedBytes()
+		}
+		return total
+	}
+	g := NewGroup("memory-used", 0, getter)
+	for i := 0; i < 10; i++ {
+		g.Get(fmt.Sprintf("k%d", i))
+	}
+	g.Remove("k0")
+	if used := atomic.LoadInt64(&arbiter.used); used != sum() {
+		t.Fatalf("running total %d should match the groups, got %d", used, sum())
+	}
+	//被替换的group不再计入
+	NewGroup("memory-used", 0, getter)
+	g.Get("k10")
+	if used := atomic.LoadInt64(&arbiter.used); used != sum() {
+		t.Fatalf("replaced group should not be counted, got %d vs %d", used, sum())
+	}
+}
@@ -0,0 +1,260 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MultiError 记录GetMulti中每个失败的key及其错误
+type MultiError map[string]error
+
+func (e MultiError) Error() string {
+	for key, err := range e {
+		return fmt.Sprintf("geecache: %d keys failed, e.g. %s: %v", len(e), key, err)
+	}
+	return "geecache: no keys failed"
+}
+
+// 一次获取多个key
+func (g *Group) GetMulti(keys []string) (map[string]ByteView, error) {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// 一次获取多个key，未命中的key按所属节点分组，每个节点只发送一次请求，
+// 属于本机的key并发加载。返回成功获取的部分结果，失败的key记录在MultiError中
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		views  = make(map[string]ByteView, len(keys))
+		errs   = make(MultiError)
+		local  []string
+		remote = make(map[PeerGetter][]string)
+		stale  = make(map[string]ByteView) //宽限期内的旧值，加载失败时返回，只在分组时写入
+	)
+	done := func(key string, view ByteView, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if v, ok := stale[key]; ok && err != nil && !errors.Is(err, ErrNotFound) {
+			g.stats.StaleServes.Add(1)
+			log.Println("[GeeCache] Serving stale value,", err)
+			view, err = v, nil
+		}
+		if err != nil {
+			errs[key] = err
+		} else {
+			views[key] = view
+		}
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		//重复的key只处理一次
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == "" {
+			errs[key] = fmt.Errorf("key is required")
+			continue
+		}
+		g.stats.Gets.Add(1)
+		//与GetContext相同：命中时按需提前刷新，只剩旧值时照常加载，失败后返回旧值
+		v, c, ok := g.lookup(key)
+		now := time.Now()
+		if ok && !v.expired(now) {
+			g.stats.CacheHits.Add(1)
+			if g.spanHook != nil {
+				_, span := g.startSpan(ctx, SpanCacheHit, key)
+				g.endSpan(span, nil)
+			}
+			if g.refreshAhead > 0 && !v.e.IsZero() && v.e.Sub(now) < g.refreshAhead {
+				g.refresh(key, c)
+			}
+			views[key] = v
+			continue
+		}
+		if ok {
+			stale[key] = v
+		} else if v, ok := g.lookupDisk(key); ok {
+			g.stats.DiskHits.Add(1)
+			views[key] = v
+			continue
+		}
+		if g.lookupNegative(key) {
+			g.stats.NegativeHits.Add(1)
+			errs[key] = ErrNotFound
+			continue
+		}
+		if g.peers != nil {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				remote[peer] = append(remote[peer], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	for peer, keys := range remote {
+		wg.Add(1)
+		go func(peer PeerGetter, keys []string) {
+			defer wg.Done()
+			g.getMultiFromPeer(ctx, peer, keys, nil, done)
+		}(peer, keys)
+	}
+	for _, key := range local {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			view, err := g.load(ctx, key)
+			done(key, view, err)
+		}(key)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return views, errs
+	}
+	return views, nil
+}
+
+// 向一个节点批量请求，请求失败时这些key改为请求下一个副本，tried为已经失败的节点
+func (g *Group) getMultiFromPeer(ctx context.Context, peer PeerGetter, keys []string,
+	tried map[PeerGetter]bool, done func(key string, view ByteView, err error)) {
+	//同getFromPeer，一批key共用一个span，Key为逗号分隔的所有key
+	peerCtx := ctx
+	if g.peerTimeout > 0 {
+		var cancel context.CancelFunc
+		peerCtx, cancel = context.WithTimeout(ctx, g.peerTimeout)
+		defer cancel()
+	}
+	peerCtx, span := g.startSpan(peerCtx, SpanPeerFetch, strings.Join(keys, ","))
+	req := &pb.MultiRequest{Group: g.name, Keys: keys}
+	traceMultiRequest(peerCtx, req)
+	res := &pb.MultiResponse{}
+	err := peer.GetMulti(peerCtx, req, res)
+	g.endSpan(span, err)
+	if err != nil {
+		g.stats.PeerErrors.Add(1)
+		log.Println("[GeeCache] Failed to get multi from peer", err)
+		g.failoverMulti(ctx, keys, withTried(tried, peer), done)
+		return
+	}
+
+	//对方加载失败或没有返回的key，与单个key一样改为请求下一个副本
+	var failed []string
+	returned := make(map[string]bool, len(res.Items))
+	for _, item := range res.Items {
+		returned[item.Key] = true
+		if item.NotFound {
+			g.stats.PeerLoads.Add(1)
+			g.populateNegative(item.Key)
+			done(item.Key, ByteView{}, ErrNotFound)
+			continue
+		}
+		if item.Error != "" {
+			g.stats.PeerErrors.Add(1)
+			log.Println("[GeeCache] Failed to get from peer", item.Key, item.Error)
+			failed = append(failed, item.Key)
+			continue
+		}
+		view, err := g.peerValue(item.Key, item.Value, item.Expire, item.Codec)
+		if err == nil {
+			g.stats.PeerLoads.Add(1)
+			if _, pos := g.replicas(item.Key, false); pos >= 0 {
+				g.populateCache(item.Key, view) //本机也是副本，保存一份
+			}
+		}
+		done(item.Key, view, err)
+	}
+	for _, key := range keys {
+		if !returned[key] {
+			g.stats.PeerErrors.Add(1)
+			log.Println("[GeeCache] Peer returned no result for", key)
+			failed = append(failed, key)
+		}
+	}
+	if len(failed) > 0 {
+		g.failoverMulti(ctx, failed, withTried(tried, peer), done)
+	}
+}
+
+// 复制tried并加入peer，并发的failover各自使用自己的副本
+func withTried(tried map[PeerGetter]bool, peer PeerGetter) map[PeerGetter]bool {
+	failed := make(map[PeerGetter]bool, len(tried)+1)
+	for p := range tried {
+		failed[p] = true
+	}
+	failed[peer] = true
+	return failed
+}
+
+// 按下一个没有失败过的副本重新分组请求，排在本机之前的副本都失败时在本机加载
+func (g *Group) failoverMulti(ctx context.Context, keys []string, tried map[PeerGetter]bool,
+	done func(key string, view ByteView, err error)) {
+	next := make(map[PeerGetter][]string)
+	var local []string
+	for _, key := range keys {
+		if peer := g.nextReplica(key, tried); peer != nil {
+			next[peer] = append(next[peer], key)
+		} else {
+			local = append(local, key)
+		}
+	}
+	var wg sync.WaitGroup
+	for peer, keys := range next {
+		wg.Add(1)
+		go func(peer PeerGetter, keys []string) {
+			defer wg.Done()
+			g.getMultiFromPeer(ctx, peer, keys, tried, done)
+		}(peer, keys)
+	}
+	for _, key := range local {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			view, err := g.loadLocally(ctx, key)
+			done(key, view, err)
+		}(key)
+	}
+	wg.Wait()
+}
+
+// 返回key排在本机之前、不在tried中的第一个副本，没有时返回nil
+func (g *Group) nextReplica(key string, tried map[PeerGetter]bool) PeerGetter {
+	peers, pos := g.replicas(key, false)
+	if pos >= 0 {
+		peers = peers[:pos]
+	}
+	for _, peer := range peers {
+		if !tried[peer] {
+			return peer
+		}
+	}
+	return nil
+}
+
+// 跳过其他节点，直接通过Getter加载，同样会与相同key的加载合并
+func (g *Group) loadLocally(ctx context.Context, key string) (ByteView, error) {
+	view, err, _ := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		loadCtx, cancel := g.detach(ctx)
+		defer cancel()
+		view, err := g.getLocally(loadCtx, key)
+		if err != nil {
+			g.stats.LocalLoadErrs.Add(1)
+			return nil, err
+		}
+		g.stats.LocalLoads.Add(1)
+		return view, nil
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
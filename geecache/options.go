@@ -0,0 +1,181 @@
+package geecache
+
+import "time"
+
+const (
+	defaultSweepInterval = time.Minute      //默认后台清理过期条目的周期
+	defaultNegativeTTL   = 10 * time.Second //默认缓存不存在结果的时间
+	defaultNegativeRatio = 8                //negCache默认容量为cacheBytes的1/8
+	defaultLoadTimeout   = time.Minute      //默认一次合并加载的超时时间
+)
+
+// GroupOption 用于在NewGroup时对Group进行可选配置
+type GroupOption func(*Group)
+
+// 设置默认过期时间，Getter没有返回存活时间时使用
+func WithExpiration(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// 设置后台清理过期条目的周期，为0时只在Get时惰性删除
+func WithSweepInterval(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.mainCache.sweepInterval = d
+		g.hotCache.sweepInterval = d
+		g.negCache.sweepInterval = d
+	}
+}
+
+// 设置主缓存的淘汰策略，如LRU、LFU、ARC、TwoQ、TinyLFU
+func WithPolicy(p PolicyFunc) GroupOption {
+	return func(g *Group) {
+		g.mainCache.newPolicy = p
+	}
+}
+
+// 设置mainCache的分片数，n<=1时不分片
+// 每个分片容量为cacheBytes/n，容量较小时实际分片数会减少
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.nshards = n
+	}
+}
+
+// 启用hotCache，cacheBytes为其容量，sample为从其他节点获取的值被放入的比例(0,1]
+func WithHotCache(cacheBytes int64, sample float64) GroupOption {
+	return func(g *Group) {
+		if cacheBytes <= 0 || sample <= 0 {
+			return
+		}
+		g.hotCache.cacheBytes = cacheBytes
+		g.hotSample = sample
+	}
+}
+
+// 设置negCache的容量和Getter返回ErrNotFound后结果的缓存时间，ttl为0时不缓存
+func WithNegativeCache(cacheBytes int64, ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negCache.cacheBytes = cacheBytes
+		g.negTTL = ttl
+	}
+}
+
+// 命中的条目距过期不足window时，在后台通过loader提前刷新，调用方继续得到当前值
+func WithRefreshAhead(window time.Duration) GroupOption {
+	return func(g *Group) {
+		g.refreshAhead = window
+	}
+}
+
+// 条目过期后继续保留grace，期间重新加载失败时返回旧值
+func WithStaleGrace(grace time.Duration) GroupOption {
+	return func(g *Group) {
+		g.mainCache.grace = grace
+		g.hotCache.grace = grace
+	}
+}
+
+// 设置共享全局内存上限(SetMemoryLimit)时的权重，默认为1，权重越大越不容易被淘汰
+func WithWeight(w float64) GroupOption {
+	return func(g *Group) {
+		if w > 0 {
+			g.weight = w
+		}
+	}
+}
+
+// 设置value的压缩方式，如Gzip、LZ，value在本机和节点之间都以压缩后的形式保存和传输
+func WithCodec(c Codec) GroupOption {
+	return func(g *Group) {
+		g.codec = c
+	}
+}
+
+// Set时同步写入数据源，写入失败时返回错误且不更新缓存
+func WithWriteThrough(s Setter) GroupOption {
+	return func(g *Group) {
+		g.setter = s
+		g.writer = nil
+	}
+}
+
+// Set时只更新缓存并加入队列，由后台批量写入数据源，o为nil时使用默认配置
+// 需要调用Group.Close保证退出前写完所有数据
+func WithWriteBehind(s Setter, o *WriteBehindOptions) GroupOption {
+	return func(g *Group) {
+		g.setter = s
+		g.writer = newWriteBehind(g, o)
+	}
+}
+
+// 最多同时进行n次数据源加载，其余的最多queue个排队等待，
+// 超过timeout仍未轮到时返回ErrLoadTimeout，timeout为0时只受加载超时(见WithLoadTimeout)限制
+// 队列已满时直接返回ErrLoadQueueFull
+func WithLoadLimit(n, queue int, timeout time.Duration) GroupOption {
+	return func(g *Group) {
+		if n > 0 {
+			g.limiter.sem = make(chan struct{}, n)
+		}
+		g.limiter.maxQueue = int64(queue)
+		g.limiter.timeout = timeout
+	}
+}
+
+// 每秒最多加载rate次数据源，允许burst次的突发，超出时返回ErrRateLimited
+func WithRateLimit(rate float64, burst int) GroupOption {
+	return func(g *Group) {
+		g.limiter.bucket = newTokenBucket(rate, burst)
+	}
+}
+
+// 启用磁盘上的第二层缓存，mainCache因容量淘汰的条目写入dir，最多保存maxBytes字节
+// 重启后仍然可以读到磁盘中的条目，退出前应调用Group.Close
+func WithDiskTier(dir string, maxBytes int64) GroupOption {
+	return func(g *Group) {
+		g.diskDir = dir
+		g.diskBytes = maxBytes
+	}
+}
+
+// 一次加载(包括请求其他节点与数据源)最多进行d，为0时不限制，默认为1分钟
+// 相同key的加载由多个调用方共享，只受这里的超时限制，调用方的ctx只限制自己的等待
+func WithLoadTimeout(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.loadTimeout = d
+	}
+}
+
+// 每次请求其他节点最多等待d，超时后尝试下一个副本或本机加载
+func WithPeerTimeout(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.peerTimeout = d
+	}
+}
+
+// 开启对冲请求：请求其他节点超过该节点最近耗时的percentile分位数(如0.95)仍未返回时，
+// 同时请求下一个副本或在本机加载，使用最先成功的结果并取消其余请求
+// 样本不足时使用fallback作为对冲延迟，fallback为0时样本不足前不对冲
+func WithHedging(percentile float64, fallback time.Duration) GroupOption {
+	return func(g *Group) {
+		g.hedgePercentile = percentile
+		g.hedgeFallback = fallback
+	}
+}
+
+// 每次缓存命中、从其他节点获取、从数据源加载结束时调用h
+func WithSpanHook(h SpanHook) GroupOption {
+	return func(g *Group) {
+		g.spanHook = h
+	}
+}
+
+// 启动时从dir恢复mainCache的快照，并每隔interval保存一次，interval为0时不定期保存
+// Group.Close时会再保存一次
+func WithSnapshot(dir string, interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.snapshotDir = dir
+		g.snapshotInterval = interval
+	}
+}
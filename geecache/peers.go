@@ -1,13 +1,43 @@
 package geecache
-import pb "geecache/geecachepb"
+
+import (
+	"context"
+	pb "geecache/geecachepb"
+)
+
+// 请求其他节点失败，Group.Set与Invalidate用它区分节点错误与数据源、编码错误
+type peerError struct{ err error }
+
+func (e *peerError) Error() string { return e.err.Error() }
+func (e *peerError) Unwrap() error { return e.err }
 
 // 抽象接口，根据PickPeer()方法，根据传入key选择对应节点PerrGetter
+// GetAll()返回除自己以外的所有节点，用于广播失效
 type PerrPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	GetAll() []PeerGetter
+}
+
+// ReplicaPicker 支持多副本的节点选择，HTTPPool实现了该接口
+// PickReplicas按副本顺序返回key的可用副本节点(不含本机)，用于读取，
+// pos为本机在其中的位置，即peers[:pos]排在本机之前；本机不是副本时pos为-1
+// AllReplicas同PickReplicas，但包括暂时不可用的节点，用于写入与删除，
+// 避免节点恢复后返回旧值
+type ReplicaPicker interface {
+	PickReplicas(key string) (peers []PeerGetter, pos int)
+	AllReplicas(key string) (peers []PeerGetter, pos int)
 }
 
 // Get()方法用于从对应group查找缓存值
+// GetMulti()方法用于一次获取多个key
+// Set()方法用于将值写入对应节点
+// Remove()方法用于删除对应节点上的本地缓存
+// RemovePrefix()方法用于删除对应节点上所有以in.Key开头的本地缓存
+// ctx用于控制请求的超时与取消
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+	GetMulti(ctx context.Context, in *pb.MultiRequest, out *pb.MultiResponse) error
+	Set(ctx context.Context, in *pb.SetRequest) error
+	Remove(ctx context.Context, in *pb.Request) error
+	RemovePrefix(ctx context.Context, in *pb.Request) error
 }
-    
\ No newline at end of file
@@ -0,0 +1,46 @@
+package geecache
+
+import (
+	"geecache/arc"
+	"geecache/lfu"
+	"geecache/lru"
+	"geecache/tinylfu"
+	"geecache/twoq"
+	"time"
+)
+
+// Policy 缓存淘汰策略，cache通过它保存条目
+// 各实现都按字节计算容量，maxBytes为0表示不限制
+type Policy interface {
+	Get(key string) (value lru.Value, ok bool)
+	AddWithExpire(key string, value lru.Value, expire time.Time)
+	Remove(key string)
+	RemoveOldest()
+	RemoveExpired()
+	Len() int
+	Bytes() int64
+	// 按从旧到新的顺序遍历，f返回false时停止
+	Range(f func(key string, value lru.Value, expire time.Time) bool)
+}
+
+// PolicyFunc 根据容量与淘汰回调创建淘汰策略
+type PolicyFunc func(maxBytes int64, onEvicted func(key string, value lru.Value)) Policy
+
+// 内置的淘汰策略，通过WithPolicy选择，默认为LRU
+var (
+	LRU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return lru.New(maxBytes, onEvicted)
+	}
+	LFU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return lfu.New(maxBytes, onEvicted)
+	}
+	ARC PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return arc.New(maxBytes, onEvicted)
+	}
+	TwoQ PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return twoq.New(maxBytes, onEvicted)
+	}
+	TinyLFU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return tinylfu.New(maxBytes, onEvicted)
+	}
+)
@@ -0,0 +1,189 @@
+package geecache
+
+import (
+	"fmt"
+	"geecache/lru"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var policies = map[string]PolicyFunc{
+	"LRU":     LRU,
+	"LFU":     LFU,
+	"ARC":     ARC,
+	"TwoQ":    TwoQ,
+	"TinyLFU": TinyLFU,
+}
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+// i<1000时，每个条目(key+"value1")都是10字节
+func entryKey(i int) string {
+	return fmt.Sprintf("k%03d", i)
+}
+
+func TestPolicyBasic(t *testing.T) {
+	for name, newPolicy := range policies {
+		p := newPolicy(0, nil)
+		p.AddWithExpire("key1", String("1234"), time.Time{})
+		if v, ok := p.Get("key1"); !ok || string(v.(String)) != "1234" {
+			t.Fatalf("%s: cache hit key1=1234 failed", name)
+		}
+		if _, ok := p.Get("key2"); ok {
+			t.Fatalf("%s: cache miss key2 failed", name)
+		}
+		p.AddWithExpire("key1", String("5678"), time.Time{})
+		if v, ok := p.Get("key1"); !ok || string(v.(String)) != "5678" || p.Len() != 1 {
+			t.Fatalf("%s: update key1 failed", name)
+		}
+		p.Remove("key1")
+		if _, ok := p.Get("key1"); ok || p.Len() != 0 {
+			t.Fatalf("%s: remove key1 failed", name)
+		}
+	}
+}
+
+func TestPolicyExpire(t *testing.T) {
+	for name, newPolicy := range policies {
+		p := newPolicy(0, nil)
+		p.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+		p.AddWithExpire("key2", String("1234"), time.Now().Add(time.Hour))
+		p.AddWithExpire("key3", String("1234"), time.Now().Add(-time.Second))
+		if _, ok := p.Get("key1"); ok || p.Len() != 2 {
+			t.Fatalf("%s: expired key1 should be removed on Get", name)
+		}
+		p.RemoveExpired()
+		if _, ok := p.Get("key2"); !ok || p.Len() != 1 {
+			t.Fatalf("%s: RemoveExpired should only remove key3", name)
+		}
+	}
+}
+
+func TestPolicyRange(t *testing.T) {
+	for name, newPolicy := range policies {
+		p := newPolicy(0, nil)
+		p.AddWithExpire("key1", String("1"), time.Time{})
+		p.AddWithExpire("key2", String("2"), time.Time{})
+		p.AddWithExpire("key3", String("3"), time.Time{})
+		var keys []string
+		p.Range(func(key string, value lru.Value, expire time.Time) bool {
+			keys = append(keys, key)
+			return true
+		})
+		if len(keys) != 3 || keys[0] != "key1" {
+			t.Fatalf("%s: Range should visit all keys from oldest, got %v", name, keys)
+		}
+		n := 0
+		p.Range(func(key string, value lru.Value, expire time.Time) bool {
+			n++
+			return false
+		})
+		if n != 1 {
+			t.Fatalf("%s: Range should stop when f returns false", name)
+		}
+	}
+}
+
+func TestPolicyCapacity(t *testing.T) {
+	for name, newPolicy := range policies {
+		evicted := 0
+		p := newPolicy(100, func(key string, value lru.Value) { evicted++ })
+		for i := 0; i < 50; i++ {
+			p.AddWithExpire(entryKey(i), String("value1"), time.Time{})
+			p.Get(entryKey(i % 7))
+		}
+		if p.Len() > 10 || p.Len() == 0 {
+			t.Fatalf("%s: expect at most 10 entries, got %d", name, p.Len())
+		}
+		if evicted != 50-p.Len() {
+			t.Fatalf("%s: expect %d evictions, got %d", name, 50-p.Len(), evicted)
+		}
+		for p.Len() > 0 {
+			p.RemoveOldest()
+		}
+	}
+}
+
+// 超过容量的条目不能放入，也不能让已用内存超过容量
+func TestPolicyOversized(t *testing.T) {
+	for name, newPolicy := range policies {
+		var evicted []string
+		p := newPolicy(100, func(key string, value lru.Value) { evicted = append(evicted, key) })
+		p.AddWithExpire(entryKey(0), String("value1"), time.Time{})
+		p.AddWithExpire("big", String(make([]byte, 200)), time.Time{})
+		if _, ok := p.Get("big"); ok || p.Bytes() > 100 {
+			t.Fatalf("%s: oversized entry should not be kept, using %d bytes", name, p.Bytes())
+		}
+		if len(evicted) == 0 || evicted[len(evicted)-1] != "big" {
+			t.Fatalf("%s: oversized entry should be evicted, got %v", name, evicted)
+		}
+		//已有的key被更新为过大的值时同样删除
+		p.AddWithExpire(entryKey(1), String("value1"), time.Time{})
+		p.AddWithExpire(entryKey(1), String(make([]byte, 200)), time.Time{})
+		if _, ok := p.Get(entryKey(1)); ok || p.Bytes() > 100 {
+			t.Fatalf("%s: oversized update should not be kept, using %d bytes", name, p.Bytes())
+		}
+	}
+}
+
+// 模拟旁路缓存：未命中时写入，返回命中率
+func hitRatio(newPolicy PolicyFunc, maxBytes int64, trace []string) float64 {
+	p := newPolicy(maxBytes, nil)
+	hits := 0
+	for _, key := range trace {
+		if _, ok := p.Get(key); ok {
+			hits++
+			continue
+		}
+		p.AddWithExpire(key, String("value1"), time.Time{})
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// 服从zipf分布的访问序列
+func zipfTrace(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.1, 1, 9999)
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = entryKey(int(z.Uint64()))
+	}
+	return trace
+}
+
+// 热点数据的访问中间穿插着一次性的全量扫描
+func scanTrace(rounds int) []string {
+	r := rand.New(rand.NewSource(1))
+	var trace []string
+	for round := 0; round < rounds; round++ {
+		for i := 0; i < 2000; i++ {
+			trace = append(trace, entryKey(r.Intn(100)))
+		}
+		for i := 0; i < 1000; i++ {
+			trace = append(trace, fmt.Sprintf("scan%d-%d", round, i))
+		}
+	}
+	return trace
+}
+
+func TestPolicyHitRatio(t *testing.T) {
+	zipf, scan := zipfTrace(100000), scanTrace(20)
+	ratios := make(map[string]float64)
+	for name, newPolicy := range policies {
+		z := hitRatio(newPolicy, 1000*10, zipf)
+		s := hitRatio(newPolicy, 200*10, scan)
+		t.Logf("%-8s zipf=%.3f scan=%.3f", name, z, s)
+		ratios[name] = s
+	}
+	//扫描时LRU会冲刷掉热点数据，其余策略应当更好
+	for name, r := range ratios {
+		if name != "LRU" && r <= ratios["LRU"] {
+			t.Errorf("%s should beat LRU on scan trace: %.3f <= %.3f", name, r, ratios["LRU"])
+		}
+	}
+}
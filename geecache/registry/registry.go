@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 节点注册中心
+// 1.缓存节点定期发送心跳进行注册
+// 2.超时未发送心跳的节点会被移除
+type GeeRegistry struct {
+	timeout time.Duration
+	mu      sync.Mutex
+	servers map[string]time.Time //节点地址 -> 最后一次心跳的时间
+}
+
+const (
+	defaultPath          = "/_geecache_/registry"
+	defaultTimeout       = time.Second * 30
+	defaultClientTimeout = time.Second * 5 //请求注册中心的超时时间
+)
+
+// 请求注册中心使用的客户端，避免注册中心无响应时一直阻塞
+var client = &http.Client{Timeout: defaultClientTimeout}
+
+// 创建注册中心实例，设置超时
+func New(timeout time.Duration) *GeeRegistry {
+	return &GeeRegistry{
+		servers: make(map[string]time.Time),
+		timeout: timeout,
+	}
+}
+
+// 默认
+var DefaultGeeRegister = New(defaultTimeout)
+
+// 添加节点，如果节点已存在，更新心跳时间
+func (r *GeeRegistry) putServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.servers[addr] = time.Now()
+}
+
+// 删除节点，节点主动退出时调用
+func (r *GeeRegistry) removeServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.servers, addr)
+}
+
+// 返回存活的节点，若超时，删除该节点
+func (r *GeeRegistry) aliveServers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var alive []string
+	for addr, last := range r.servers {
+		if r.timeout == 0 || last.Add(r.timeout).After(time.Now()) {
+			alive = append(alive, addr)
+		} else {
+			delete(r.servers, addr)
+		}
+	}
+	sort.Strings(alive)
+	return alive
+}
+
+func (r *GeeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		w.Header().Set("X-Geecache-Servers", strings.Join(r.aliveServers(), ","))
+	case "POST":
+		addr := req.Header.Get("X-Geecache-Server")
+		if addr == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.putServer(addr)
+	case "DELETE":
+		addr := req.Header.Get("X-Geecache-Server")
+		if addr == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.removeServer(addr)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *GeeRegistry) HandleHTTP(registryPath string) {
+	http.Handle(registryPath, r)
+	log.Println("geecache registry path", registryPath)
+}
+
+func HandleHTTP() {
+	DefaultGeeRegister.HandleHTTP(defaultPath)
+}
+
+// 节点启动后定时发送心跳，默认周期为注册中心过期时间的三分之一
+// 发送失败时不退出，注册中心恢复后节点会重新出现
+// 返回的stop停止发送心跳，并从注册中心注销该节点
+func Heartbeat(registry, addr string, duration time.Duration) (stop func()) {
+	if duration == 0 {
+		duration = defaultTimeout / 3
+	}
+	sendHeartbeat(registry, addr)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		t := time.NewTicker(duration)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				sendHeartbeat(registry, addr)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited //等待正在发送的心跳，避免注销后又被注册
+			Deregister(registry, addr)
+		})
+	}
+}
+
+// 发送心跳包
+func sendHeartbeat(registry, addr string) error {
+	req, _ := http.NewRequest("POST", registry, nil)
+	req.Header.Set("X-Geecache-Server", addr)
+	res, err := client.Do(req)
+	if err != nil {
+		log.Println("geecache: heart beat err:", err)
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// 从注册中心注销节点，其他节点下次同步时将其移除
+func Deregister(registry, addr string) error {
+	req, _ := http.NewRequest("DELETE", registry, nil)
+	req.Header.Set("X-Geecache-Server", addr)
+	res, err := client.Do(req)
+	if err != nil {
+		log.Println("geecache: deregister err:", err)
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry returned: %v", res.Status)
+	}
+	return nil
+}
+
+// 从注册中心获取存活的节点
+func Servers(registry string) ([]string, error) {
+	res, err := client.Get(registry)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned: %v", res.Status)
+	}
+	var servers []string
+	for _, addr := range strings.Split(res.Header.Get("X-Geecache-Servers"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			servers = append(servers, addr)
+		}
+	}
+	return servers, nil
+}
@@ -0,0 +1,242 @@
+package geecache
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Setter 将Group.Set写入的数据保存到数据源
+type Setter interface {
+	Set(key string, value []byte) error
+}
+
+// 接口型函数，同GetterFunc
+type SetterFunc func(key string, value []byte) error
+
+func (f SetterFunc) Set(key string, value []byte) error {
+	return f(key, value)
+}
+
+// BatchSetter 可选实现，write-behind时一次写入一批数据
+// 返回错误时整批视为失败
+type BatchSetter interface {
+	Setter
+	SetBatch(items map[string][]byte) error
+}
+
+const (
+	defaultWriteBatchSize    = 100
+	defaultWriteInterval     = time.Second
+	defaultWriteRetries      = 3
+	defaultWriteRetryBackoff = 100 * time.Millisecond
+)
+
+// WriteBehindOptions write-behind的可选配置
+type WriteBehindOptions struct {
+	BatchSize    int           //每批最多写入的key数，默认为100，积压达到该数量时立即写入
+	Interval     time.Duration //定期写入的周期，默认为1秒
+	MaxRetries   int           //写入失败后的重试次数，默认为3，小于0表示不重试
+	RetryBackoff time.Duration //第一次重试前的等待时间，之后每次翻倍，默认为100毫秒
+}
+
+// Setter写入数据源失败
+type backendError struct{ err error }
+
+func (e *backendError) Error() string { return e.err.Error() }
+func (e *backendError) Unwrap() error { return e.err }
+
+// 写入数据源，并记录统计
+func (g *Group) writeBackend(key string, value []byte) error {
+	g.stats.BackendWrites.Add(1)
+	if err := g.setter.Set(key, value); err != nil {
+		g.stats.BackendWriteErrs.Add(1)
+		return &backendError{err}
+	}
+	return nil
+}
+
+// 后台批量写入数据源，同一个key只保留最后一次写入的值
+type writeBehind struct {
+	g        *Group
+	opts     WriteBehindOptions
+	mu       sync.Mutex
+	pending  map[string][]byte //等待写入的数据
+	inflight map[string][]byte //正在写入的数据
+	closed   bool
+	kick     chan struct{} //积压达到BatchSize时通知立即写入
+	stop     chan struct{}
+	done     chan error //Close时返回最后一次写入的错误
+}
+
+func newWriteBehind(g *Group, o *WriteBehindOptions) *writeBehind {
+	w := &writeBehind{
+		g:        g,
+		pending:  make(map[string][]byte),
+		inflight: make(map[string][]byte),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan error, 1),
+	}
+	if o != nil {
+		w.opts = *o
+	}
+	if w.opts.BatchSize <= 0 {
+		w.opts.BatchSize = defaultWriteBatchSize
+	}
+	if w.opts.Interval <= 0 {
+		w.opts.Interval = defaultWriteInterval
+	}
+	if w.opts.MaxRetries == 0 {
+		w.opts.MaxRetries = defaultWriteRetries
+	}
+	if w.opts.RetryBackoff <= 0 {
+		w.opts.RetryBackoff = defaultWriteRetryBackoff
+	}
+	return w
+}
+
+func (w *writeBehind) start() {
+	go func() {
+		t := time.NewTicker(w.opts.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-w.kick:
+			case <-w.stop:
+				w.done <- w.flush()
+				return
+			}
+			w.flush()
+		}
+	}()
+}
+
+// 加入队列，已经Close时返回false
+func (w *writeBehind) enqueue(key string, value []byte) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	w.pending[key] = value
+	if len(w.pending) >= w.opts.BatchSize {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// 查找还没有写入数据源的值，避免缓存被淘汰后从数据源读到旧值
+func (w *writeBehind) lookup(key string) ([]byte, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if v, ok := w.pending[key]; ok {
+		return v, true
+	}
+	v, ok := w.inflight[key]
+	return v, ok
+}
+
+func (w *writeBehind) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// 分批写入所有积压的数据，返回最后一个错误
+func (w *writeBehind) flush() error {
+	var lastErr error
+	for {
+		w.mu.Lock()
+		batch := make(map[string][]byte)
+		for key, value := range w.pending {
+			if len(batch) == w.opts.BatchSize {
+				break
+			}
+			batch[key] = value
+			w.inflight[key] = value
+			delete(w.pending, key)
+		}
+		w.mu.Unlock()
+		if len(batch) == 0 {
+			return lastErr
+		}
+		if err := w.writeBatch(batch); err != nil {
+			lastErr = err
+		}
+	}
+}
+
+// 写入一批数据，失败的部分按退避时间重试
+// 重试用尽后删除缓存中的值，让之后的读取回到数据源，保持与数据源一致
+func (w *writeBehind) writeBatch(batch map[string][]byte) error {
+	all := batch
+	var err error
+	backoff := w.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		batch, err = w.write(batch)
+		if len(batch) == 0 || attempt >= w.opts.MaxRetries {
+			break
+		}
+		w.g.stats.WriteRetries.Add(1)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	//先移出inflight，再删除缓存，避免读取时又从inflight拿到未写入的值
+	var failed []string
+	w.mu.Lock()
+	for key := range all {
+		delete(w.inflight, key)
+	}
+	for key := range batch {
+		//之后又有新的写入时，交给新的写入处理
+		if _, ok := w.pending[key]; !ok {
+			failed = append(failed, key)
+		}
+	}
+	w.mu.Unlock()
+	for _, key := range failed {
+		log.Println("[GeeCache] Failed to write behind", key, err)
+		w.g.Invalidate(key)
+	}
+	return err
+}
+
+// 写入数据源，返回写入失败的部分
+func (w *writeBehind) write(batch map[string][]byte) (map[string][]byte, error) {
+	if bs, ok := w.g.setter.(BatchSetter); ok {
+		w.g.stats.BackendWrites.Add(int64(len(batch)))
+		if err := bs.SetBatch(batch); err != nil {
+			w.g.stats.BackendWriteErrs.Add(int64(len(batch)))
+			return batch, err
+		}
+		return nil, nil
+	}
+	var lastErr error
+	failed := make(map[string][]byte)
+	for key, value := range batch {
+		if err := w.g.writeBackend(key, value); err != nil {
+			failed[key] = value
+			lastErr = err
+		}
+	}
+	return failed, lastErr
+}
+
+// 停止接收新的写入，写完所有积压的数据
+func (w *writeBehind) close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.stop)
+	return <-w.done
+}
@@ -0,0 +1,163 @@
+package geecache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录写入的数据源，fail返回true的key写入失败
+type fakeStore struct {
+	mu      sync.Mutex
+	data    map[string]string
+	batches []int
+	fail    func(key string) bool
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{data: map[string]string{}}
+}
+
+func (s *fakeStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.data[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *fakeStore) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil && s.fail(key) {
+		return errors.New("store unavailable")
+	}
+	s.data[key] = string(value)
+	return nil
+}
+
+func (s *fakeStore) get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key]
+}
+
+// 支持批量写入的数据源
+type fakeBatchStore struct {
+	*fakeStore
+}
+
+func (s fakeBatchStore) SetBatch(items map[string][]byte) error {
+	s.mu.Lock()
+	s.batches = append(s.batches, len(items))
+	s.mu.Unlock()
+	for key, value := range items {
+		if err := s.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWriteThrough(t *testing.T) {
+	store := newFakeStore()
+	gee := NewGroup("writethrough", 2<<10, store, WithWriteThrough(store))
+
+	if err := gee.Set("k", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if store.get("k") != "v1" {
+		t.Fatal("Set should write to the store synchronously")
+	}
+
+	store.fail = func(string) bool { return true }
+	if err := gee.Set("k", []byte("v2"), 0); err == nil {
+		t.Fatal("Set should return the store error")
+	}
+	if view, err := gee.Get("k"); err != nil || view.String() != "v1" {
+		t.Fatalf("failed write should not update the cache, got %s", view)
+	}
+	if s := gee.Stats(); s.BackendWrites != 2 || s.BackendWriteErrs != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	store := newFakeStore()
+	gee := NewGroup("writebehind", 2<<10, store, WithWriteBehind(fakeBatchStore{store},
+		&WriteBehindOptions{BatchSize: 2, Interval: time.Hour}))
+
+	if err := gee.Set("a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if store.get("a") != "" {
+		t.Fatal("write-behind should not write synchronously")
+	}
+	if n := gee.Stats().WritesPending; n != 1 {
+		t.Fatalf("expected 1 pending write, got %d", n)
+	}
+	//缓存中没有时，应读到还没写入数据源的值
+	gee.removeLocally("a")
+	if view, err := gee.Get("a"); err != nil || view.String() != "1" {
+		t.Fatalf("pending value should be served, got %s %v", view, err)
+	}
+
+	//积压达到BatchSize时立即写入
+	gee.Set("b", []byte("2"), 0)
+	deadline := time.Now().Add(time.Second)
+	for store.get("b") == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if store.get("a") != "1" || store.get("b") != "2" {
+		t.Fatal("full batch should be written")
+	}
+
+	gee.Set("c", []byte("3"), 0)
+	if err := gee.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if store.get("c") != "3" {
+		t.Fatal("Close should flush pending writes")
+	}
+	if len(store.batches) != 2 || store.batches[0] != 2 || store.batches[1] != 1 {
+		t.Fatalf("unexpected batches %v", store.batches)
+	}
+	//Close之后同步写入
+	gee.Set("d", []byte("4"), 0)
+	if store.get("d") != "4" {
+		t.Fatal("Set after Close should write synchronously")
+	}
+}
+
+func TestWriteBehindRetry(t *testing.T) {
+	store := newFakeStore()
+	var mu sync.Mutex
+	failures := map[string]int{"flaky": 2, "broken": 100}
+	store.fail = func(key string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		failures[key]--
+		return failures[key] >= 0
+	}
+	store.data["broken"] = "old"
+	gee := NewGroup("writebehindretry", 2<<10, store, WithWriteBehind(store,
+		&WriteBehindOptions{Interval: time.Hour, MaxRetries: 2, RetryBackoff: time.Millisecond}))
+
+	gee.Set("flaky", []byte("new"), 0)
+	gee.Set("broken", []byte("new"), 0)
+	if err := gee.Close(); err == nil {
+		t.Fatal("Close should report the permanent failure")
+	}
+	if store.get("flaky") != "new" {
+		t.Fatal("flaky write should succeed after retries")
+	}
+	//重试用尽后删除缓存，之后的读取与数据源一致
+	if view, err := gee.Get("broken"); err != nil || view.String() != "old" {
+		t.Fatalf("failed write should be invalidated, got %s", view)
+	}
+	if s := gee.Stats(); s.WriteRetries != 2 || s.BackendWriteErrs != 5 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
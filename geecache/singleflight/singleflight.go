@@ -1,12 +1,40 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// fn中调用了runtime.Goexit
+var errGoexit = errors.New("singleflight: fn called runtime.Goexit")
+
+// PanicError fn发生panic时，作为错误返回给所有等待者
+type PanicError struct {
+	Value interface{} //recover()得到的值
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: fn panicked: %v\n\n%s", p.Value, p.Stack)
+}
+
+// DoChan返回的结果，Shared表示结果是否被多个调用方共享
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
 
 // 正在进行或已经结束的请求
 type call struct {
-	wg  sync.WaitGroup
-	Val interface{}
-	err error
+	wg    sync.WaitGroup
+	Val   interface{}
+	err   error
+	dups  int             //合并进来的调用方数量
+	chans []chan<- Result //DoChan的调用方
 }
 
 // 管理不同请求,主数据结构
@@ -16,28 +44,97 @@ type Group struct {
 }
 
 // 保证相同的请求,fn只会被调用一次
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// shared表示结果是否被多个调用方共享
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call) //延迟初始化
 	}
 	//相同的请求已经存在，没必要再次添加
 	if c, ok := g.m[key]; ok {
+		c.dups++
 		g.mu.Unlock()
 		c.wg.Wait() //等待请求完成
-		return c.Val, c.err
+		return c.Val, c.err, true
 	}
 	c := new(call)
 	c.wg.Add(1)
 	g.m[key] = c
 	g.mu.Unlock()
 
-	//这个其实就是,发起请求
-	c.Val, c.err = fn()
-	c.wg.Done() //请求结束
+	g.doCall(c, key, fn)
+	return c.Val, c.err, c.dups > 0
+}
 
+// 与Do相同，但不阻塞，fn在新的goroutine中执行，结果从返回的channel中读取
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
 	g.mu.Lock()
-	delete(g.m, key) //请求结束，删除
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{chans: []chan<- Result{ch}}
+	c.wg.Add(1)
+	g.m[key] = c
 	g.mu.Unlock()
-	return c.Val, c.err
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// 与Do相同，但ctx结束时立即返回ctx.Err()
+// 只是当前调用方放弃等待，fn会继续执行，其他调用方仍能得到结果
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	select {
+	case res := <-g.DoChan(key, fn):
+		return res.Val, res.Err, res.Shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), false
+	}
+}
+
+// 不再合并key正在进行的请求，之后的调用会重新执行fn
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+}
+
+// 执行fn，fn发生panic或Goexit时也会唤醒所有等待者
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	normalReturn := false
+	defer func() {
+		if !normalReturn && c.err == nil {
+			c.err = errGoexit
+		}
+		g.mu.Lock()
+		c.wg.Done() //请求结束
+		//Forget之后，key可能已经对应新的请求
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		for _, ch := range c.chans {
+			ch <- Result{c.Val, c.err, c.dups > 0}
+		}
+		g.mu.Unlock()
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				if r := recover(); r != nil {
+					c.err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}
+		}()
+		//这个其实就是,发起请求
+		c.Val, c.err = fn()
+		normalReturn = true
+	}()
 }
@@ -0,0 +1,121 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil || shared {
+		t.Fatalf("Do = %v, %v, %v", v, err, shared)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	var wg sync.WaitGroup
+	var sharedCount int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, _, shared := g.Do("key", fn); v != "bar" {
+				t.Errorf("got %v", v)
+			} else if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 || sharedCount != 10 {
+		t.Fatalf("expect 1 call shared by 10 callers, got %d calls, %d shared", calls, sharedCount)
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	waiter := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		panic("boom")
+	})
+	done := make(chan error)
+	go func() {
+		_, err, _ := g.Do("key", func() (interface{}, error) { return nil, nil })
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	var pe *PanicError
+	if res := <-waiter; !errors.As(res.Err, &pe) || pe.Value != "boom" || !res.Shared {
+		t.Fatalf("expect PanicError, got %v", res.Err)
+	}
+	select {
+	case err := <-done:
+		if !errors.As(err, &pe) {
+			t.Fatalf("waiter should get PanicError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter deadlocked after panic")
+	}
+	if v, err, _ := g.Do("key", func() (interface{}, error) { return "ok", nil }); v != "ok" || err != nil {
+		t.Fatal("key should be usable after panic")
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	g.Forget("key")
+	second := g.DoChan("key", func() (interface{}, error) { return 2, nil })
+	if res := <-second; res.Val != 2 {
+		t.Fatalf("call after Forget should run fn again, got %v", res.Val)
+	}
+	close(release)
+	if res := <-first; res.Val != 1 {
+		t.Fatalf("forgotten call should still finish, got %v", res.Val)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	}
+	other := g.DoChan("key", fn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoContext(ctx, "key", fn); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	close(release)
+	if res := <-other; res.Val != "bar" || res.Err != nil || !res.Shared {
+		t.Fatalf("other waiters should not be cancelled, got %+v", res)
+	}
+}
@@ -0,0 +1,187 @@
+package geecache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照格式:
+// magic(4字节"GEES") | version(1字节) | 条目... | 结束标记(uvarint 0)
+// 条目: keyLen(uvarint) | key | valueLen(uvarint) | value | expire(varint, UnixNano, 0表示永不过期) |
+// codecLen(uvarint) | codec(value的压缩方式，version 2起才有)
+// key不能为空，所以keyLen为0可以作为结束标记
+const (
+	snapshotMagic   = "GEES"
+	snapshotVersion = 2
+	maxSnapshotLen  = 1 << 30 //单个key或value的最大长度，防止读到损坏的数据时分配过多内存
+)
+
+var ErrSnapshotFormat = errors.New("geecache: invalid snapshot")
+
+// 将mainCache中未过期的条目写入w
+func (g *Group) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+
+	var err error
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeBytes := func(b []byte) {
+		n := binary.PutUvarint(buf, uint64(len(b)))
+		bw.Write(buf[:n])
+		_, err = bw.Write(b)
+	}
+	g.mainCache.rangeEntries(func(key string, value ByteView) bool {
+		writeBytes([]byte(key))
+		writeBytes(value.b)
+		n := binary.PutVarint(buf, unixNano(value.e))
+		bw.Write(buf[:n])
+		writeBytes([]byte(codecName(value.c)))
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteByte(0)
+	return bw.Flush()
+}
+
+// 从r中读取快照写入mainCache，跳过已过期的条目
+func (g *Group) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("reading snapshot header: %v", err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return ErrSnapshotFormat
+	}
+	version := header[len(snapshotMagic)]
+	if version < 1 || version > snapshotVersion {
+		return fmt.Errorf("geecache: unsupported snapshot version %d", version)
+	}
+
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxSnapshotLen {
+			return nil, ErrSnapshotFormat
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return b, err
+	}
+	now := time.Now()
+	for {
+		key, err := readBytes()
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %v", err)
+		}
+		if len(key) == 0 {
+			return nil
+		}
+		value, err := readBytes()
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %v", err)
+		}
+		expire, err := binary.ReadVarint(br)
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %v", err)
+		}
+		view := ByteView{b: value, e: fromUnixNano(expire)}
+		if version >= 2 {
+			codec, err := readBytes()
+			if err != nil {
+				return fmt.Errorf("reading snapshot: %v", err)
+			}
+			if view.c, err = codecByName(string(codec)); err != nil {
+				return err
+			}
+		}
+		if !view.e.IsZero() && now.After(view.e) {
+			continue
+		}
+		g.mainCache.add(string(key), view)
+	}
+}
+
+// 快照文件的路径，group名经过转义
+func (g *Group) snapshotPath(dir string) string {
+	return filepath.Join(dir, url.PathEscape(g.name)+".snapshot")
+}
+
+// 将快照写入dir，先写临时文件再重命名，避免留下不完整的快照
+func (g *Group) SaveSnapshot(dir string) error {
+	f, err := os.CreateTemp(dir, url.PathEscape(g.name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = g.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), g.snapshotPath(dir))
+}
+
+// 从dir中恢复快照，快照不存在时不做任何事
+func (g *Group) LoadSnapshot(dir string) error {
+	f, err := os.Open(g.snapshotPath(dir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.Restore(f)
+}
+
+// 启动时恢复快照，之后每隔interval保存一次，直到Close
+func (g *Group) startSnapshot(dir string, interval time.Duration) {
+	if err := g.LoadSnapshot(dir); err != nil {
+		log.Println("[GeeCache] Failed to restore snapshot", err)
+	}
+	if interval <= 0 {
+		return
+	}
+	g.snapshotStop = make(chan struct{})
+	g.snapshotDone = make(chan struct{})
+	go func() {
+		defer close(g.snapshotDone)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := g.SaveSnapshot(dir); err != nil {
+					log.Println("[GeeCache] Failed to save snapshot", err)
+				}
+			case <-g.snapshotStop:
+				return
+			}
+		}
+	}()
+}
+
+// Close时调用，停止定期保存，并保存最后一次快照
+func (g *Group) stopSnapshot() error {
+	if g.snapshotStop != nil {
+		close(g.snapshotStop)
+		<-g.snapshotDone
+	}
+	return g.SaveSnapshot(g.snapshotDir)
+}
@@ -0,0 +1,89 @@
+package geecache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("db"), nil
+	})
+	src := NewGroup("snapshot-src", 2<<10, getter)
+	src.Set("k1", []byte("v1"), 0)
+	src.Set("k2", []byte("v2"), time.Hour)
+	src.Set("k3", []byte("v3"), 20*time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	dst := NewGroup("snapshot-dst", 2<<10, getter)
+	if err := dst.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if s := dst.mainCache.stats(); s.Items != 2 {
+		t.Fatalf("expired entry should be skipped, got %d items", s.Items)
+	}
+	for key, value := range map[string]string{"k1": "v1", "k2": "v2"} {
+		if view, err := dst.Get(key); err != nil || view.String() != value {
+			t.Fatalf("expect %s=%s after restore, got %s", key, value, view)
+		}
+	}
+	want, _ := src.lookupCache("k2")
+	if got, _ := dst.lookupCache("k2"); !got.Expire().Equal(want.Expire()) {
+		t.Fatalf("expire time should be restored, got %v want %v", got.Expire(), want.Expire())
+	}
+	if loads != 0 {
+		t.Fatalf("restored keys should not be loaded, got %d loads", loads)
+	}
+
+	if err := dst.Restore(bytes.NewReader([]byte("bad snapshot"))); err != ErrSnapshotFormat {
+		t.Fatalf("expect ErrSnapshotFormat, got %v", err)
+	}
+	if err := dst.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-3])); err == nil {
+		t.Fatal("truncated snapshot should fail")
+	}
+}
+
+func TestSnapshotDir(t *testing.T) {
+	dir := t.TempDir()
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("db"), nil })
+	g := NewGroup("snapshot/dir", 2<<10, getter, WithSnapshot(dir, 0))
+	g.Set("Tom", []byte("630"), 0)
+	if err := g.SaveSnapshot(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	//模拟重启
+	g = NewGroup("snapshot/dir", 2<<10, getter, WithSnapshot(dir, 0))
+	if view, ok := g.lookupCache("Tom"); !ok || view.String() != "630" {
+		t.Fatal("group should be restored from snapshot dir on startup")
+	}
+}
+
+func TestSnapshotOnClose(t *testing.T) {
+	dir := t.TempDir()
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte("db"), nil })
+	g := NewGroup("snapshot/close", 2<<10, getter, WithSnapshot(dir, time.Hour))
+	g.Set("Tom", []byte("630"), 0)
+	//定期保存还没有发生，Close时保存
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-g.snapshotDone:
+	default:
+		t.Fatal("periodic snapshot should stop on Close")
+	}
+
+	g = NewGroup("snapshot/close", 2<<10, getter, WithSnapshot(dir, 0))
+	if view, ok := g.lookupCache("Tom"); !ok || view.String() != "630" {
+		t.Fatal("snapshot saved on Close should be restored")
+	}
+}
@@ -0,0 +1,163 @@
+package geecache
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// AtomicInt 可并发使用的计数器
+type AtomicInt int64
+
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+// Group内部的计数器
+type groupStats struct {
+	Gets             AtomicInt //Get的调用次数
+	CacheHits        AtomicInt //命中mainCache或hotCache的次数
+	NegativeHits     AtomicInt //命中negCache，直接返回ErrNotFound的次数
+	Loads            AtomicInt //未命中后进入load的次数
+	LoadsDeduped     AtomicInt //load时与其他请求合并，没有真正执行的次数
+	PeerLoads        AtomicInt //从其他节点成功获取的次数
+	PeerErrors       AtomicInt //从其他节点获取失败的次数
+	LocalLoads       AtomicInt //通过Getter成功获取的次数
+	LocalLoadErrs    AtomicInt //通过Getter获取失败的次数
+	ServerRequests   AtomicInt //收到其他节点请求的次数
+	Refreshes        AtomicInt //后台提前刷新的次数
+	RefreshErrs      AtomicInt //后台刷新失败的次数
+	StaleServes      AtomicInt //加载失败后返回过期旧值的次数
+	BackendWrites    AtomicInt //通过Setter写入数据源的次数
+	BackendWriteErrs AtomicInt //写入数据源失败的次数
+	WriteRetries     AtomicInt //write-behind重试的次数
+	LoadsQueued      AtomicInt //等待数据源加载名额的次数
+	LoadsRejected    AtomicInt //被并发限制或速率限制拒绝的加载次数
+	Hedges           AtomicInt //发出对冲请求的次数
+	DiskHits         AtomicInt //命中磁盘缓存的次数
+	DiskSpills       AtomicInt //mainCache淘汰的条目写入磁盘的次数
+	DiskErrors       AtomicInt //读写磁盘缓存失败的次数
+}
+
+// Stats 某一时刻Group统计数据的快照
+type Stats struct {
+	Gets             int64      `json:"gets"`
+	Hits             int64      `json:"hits"`
+	Misses           int64      `json:"misses"`
+	NegativeHits     int64      `json:"negative_hits"`
+	Loads            int64      `json:"loads"`
+	LoadsDeduped     int64      `json:"loads_deduped"`
+	PeerLoads        int64      `json:"peer_loads"`
+	PeerErrors       int64      `json:"peer_errors"`
+	LocalLoads       int64      `json:"local_loads"`
+	LocalLoadErrs    int64      `json:"local_load_errs"`
+	ServerRequests   int64      `json:"server_requests"`
+	Refreshes        int64      `json:"refreshes"`
+	RefreshErrs      int64      `json:"refresh_errs"`
+	StaleServes      int64      `json:"stale_serves"`
+	BackendWrites    int64      `json:"backend_writes"`
+	BackendWriteErrs int64      `json:"backend_write_errs"`
+	WriteRetries     int64      `json:"write_retries"`
+	WritesPending    int64      `json:"writes_pending"` //write-behind等待写入的key数
+	LoadsQueued      int64      `json:"loads_queued"`
+	LoadsRejected    int64      `json:"loads_rejected"`
+	LoadsInFlight    int64      `json:"loads_in_flight"` //正在进行的数据源加载数，只在设置了并发限制时统计
+	Hedges           int64      `json:"hedges"`
+	DiskHits         int64      `json:"disk_hits"`
+	DiskSpills       int64      `json:"disk_spills"`
+	DiskErrors       int64      `json:"disk_errors"`
+	DiskBytes        int64      `json:"disk_bytes"`
+	DiskItems        int64      `json:"disk_items"`
+	Evictions        int64      `json:"evictions"`
+	Bytes            int64      `json:"bytes"`
+	Items            int64      `json:"items"`
+	MainCache        CacheStats `json:"main_cache"`
+	HotCache         CacheStats `json:"hot_cache"`
+	NegCache         CacheStats `json:"neg_cache"`
+	Memory           Allocation `json:"memory"`
+}
+
+// CacheStats 单个cache的统计数据
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`
+	Items     int64 `json:"items"`
+	Gets      int64 `json:"gets"`
+	Hits      int64 `json:"hits"`
+	Evictions int64 `json:"evictions"`
+}
+
+// 返回当前统计数据的快照
+func (g *Group) Stats() Stats {
+	s := Stats{
+		Gets:             g.stats.Gets.Get(),
+		Hits:             g.stats.CacheHits.Get(),
+		NegativeHits:     g.stats.NegativeHits.Get(),
+		Loads:            g.stats.Loads.Get(),
+		LoadsDeduped:     g.stats.LoadsDeduped.Get(),
+		PeerLoads:        g.stats.PeerLoads.Get(),
+		PeerErrors:       g.stats.PeerErrors.Get(),
+		LocalLoads:       g.stats.LocalLoads.Get(),
+		LocalLoadErrs:    g.stats.LocalLoadErrs.Get(),
+		ServerRequests:   g.stats.ServerRequests.Get(),
+		Refreshes:        g.stats.Refreshes.Get(),
+		RefreshErrs:      g.stats.RefreshErrs.Get(),
+		StaleServes:      g.stats.StaleServes.Get(),
+		BackendWrites:    g.stats.BackendWrites.Get(),
+		BackendWriteErrs: g.stats.BackendWriteErrs.Get(),
+		WriteRetries:     g.stats.WriteRetries.Get(),
+		LoadsQueued:      g.stats.LoadsQueued.Get(),
+		LoadsRejected:    g.stats.LoadsRejected.Get(),
+		LoadsInFlight:    int64(len(g.limiter.sem)),
+		Hedges:           g.stats.Hedges.Get(),
+		DiskHits:         g.stats.DiskHits.Get(),
+		DiskSpills:       g.stats.DiskSpills.Get(),
+		DiskErrors:       g.stats.DiskErrors.Get(),
+		MainCache:        g.mainCache.stats(),
+		HotCache:         g.hotCache.stats(),
+		NegCache:         g.negCache.stats(),
+		Memory:           g.allocation(),
+	}
+	s.Misses = s.Gets - s.Hits - s.DiskHits
+	s.Evictions = s.MainCache.Evictions + s.HotCache.Evictions
+	s.Bytes = s.MainCache.Bytes + s.HotCache.Bytes
+	s.Items = s.MainCache.Items + s.HotCache.Items
+	if g.writer != nil {
+		s.WritesPending = int64(g.writer.len())
+	}
+	if g.diskStore != nil {
+		s.DiskBytes = g.diskStore.Bytes()
+		s.DiskItems = int64(g.diskStore.Len())
+	}
+	return s
+}
+
+// 以JSON格式返回统计数据
+// "/_geecache_stats/"返回所有Group，"/_geecache_stats/scores"返回指定Group
+func (p *HTTPPool) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body interface{}
+	if name := strings.Trim(r.URL.Path[len(p.statsPath):], "/"); name != "" {
+		group := GetGroup(name)
+		if group == nil {
+			http.Error(w, "no such group: "+name, http.StatusNotFound)
+			return
+		}
+		body = group.Stats()
+	} else {
+		all := make(map[string]Stats)
+		for _, group := range allGroups() {
+			all[group.name] = group.Stats()
+		}
+		body = all
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
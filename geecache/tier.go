@@ -0,0 +1,107 @@
+package geecache
+
+import (
+	"errors"
+	"geecache/disk"
+	"log"
+	"strings"
+)
+
+// 第二层缓存：mainCache因容量淘汰的条目写入本机磁盘，
+// 读取时依次查找内存、磁盘、其他节点和Getter
+// 磁盘中只保存不在mainCache中的条目，读到后放回mainCache并从磁盘删除
+
+var errDiskValue = errors.New("geecache: corrupt disk value")
+
+// 在NewGroup中打开磁盘存储，失败时只使用内存
+func (g *Group) openDisk() {
+	store, err := disk.Open(g.diskDir, g.diskBytes)
+	if err != nil {
+		log.Println("[GeeCache] Failed to open disk store", err)
+		return
+	}
+	g.diskStore = store
+	g.mainCache.spill = g.spill
+}
+
+// mainCache淘汰条目后调用，此时已释放分片的锁，写磁盘不会阻塞对该分片的读写
+func (g *Group) spill(key string, value ByteView) {
+	if err := g.diskStore.Put(key, encodeDiskValue(value), value.e); err != nil {
+		g.stats.DiskErrors.Add(1)
+		log.Println("[GeeCache] Failed to spill to disk", key, err)
+		return
+	}
+	g.stats.DiskSpills.Add(1)
+}
+
+// 从磁盘读取key，读到后放回mainCache
+func (g *Group) lookupDisk(key string) (ByteView, bool) {
+	if g.diskStore == nil {
+		return ByteView{}, false
+	}
+	b, expire, ok := g.diskStore.Get(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	value, err := decodeDiskValue(b)
+	if err != nil {
+		g.stats.DiskErrors.Add(1)
+		log.Println("[GeeCache] Failed to read from disk", key, err)
+		g.diskStore.Delete(key)
+		return ByteView{}, false
+	}
+	value.e = expire
+	g.populateCache(key, value)
+	return value, true
+}
+
+// 删除磁盘中的key，populateCache与删除缓存时调用，保证磁盘中不会留下旧值
+func (g *Group) removeDisk(key string) {
+	if g.diskStore == nil {
+		return
+	}
+	g.mainCache.cancelSpill(key)
+	//已过期的记录也要删除，Delete只在key在索引中时写入删除记录
+	if err := g.diskStore.Delete(key); err != nil {
+		g.stats.DiskErrors.Add(1)
+		log.Println("[GeeCache] Failed to delete from disk", key, err)
+	}
+}
+
+// 删除磁盘中所有以prefix开头的key
+func (g *Group) removeDiskPrefix(prefix string) int {
+	if g.diskStore == nil {
+		return 0
+	}
+	g.mainCache.cancelSpillPrefix(prefix)
+	n := 0
+	for _, key := range g.diskStore.Keys() {
+		if strings.HasPrefix(key, prefix) {
+			g.removeDisk(key)
+			n++
+		}
+	}
+	return n
+}
+
+// 磁盘中的value: codec名字的长度(1字节) | codec名字 | value
+// 压缩过的value原样保存
+func encodeDiskValue(v ByteView) []byte {
+	name := codecName(v.c)
+	buf := make([]byte, 0, 1+len(name)+len(v.b))
+	buf = append(buf, byte(len(name)))
+	buf = append(buf, name...)
+	return append(buf, v.b...)
+}
+
+func decodeDiskValue(b []byte) (ByteView, error) {
+	if len(b) == 0 || len(b) < 1+int(b[0]) {
+		return ByteView{}, errDiskValue
+	}
+	n := 1 + int(b[0])
+	c, err := codecByName(string(b[1:n]))
+	if err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: b[n:], c: c}, nil
+}
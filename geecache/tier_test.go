@@ -0,0 +1,53 @@
+package geecache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDiskTier(t *testing.T) {
+	dir := t.TempDir()
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("value-" + key), nil
+	})
+	gee := NewGroup("disktier", 64, getter, WithDiskTier(dir, 1<<20), WithCodec(Gzip))
+	for i := 0; i < 10; i++ {
+		gee.Get(fmt.Sprintf("k%d", i))
+	}
+	if s := gee.Stats(); s.DiskSpills == 0 || s.DiskItems == 0 || loads != 10 {
+		t.Fatalf("evicted entries should spill to disk, got %+v", s)
+	}
+
+	//内存中没有时从磁盘读取，不再请求数据源
+	if view, err := gee.Get("k0"); err != nil || view.String() != "value-k0" || loads != 10 {
+		t.Fatalf("k0 should be read from disk, got %s, %v", view, err)
+	}
+	if s := gee.Stats(); s.DiskHits != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	//删除时磁盘中的副本也被删除
+	if !gee.diskStore.Contains("k1") {
+		t.Fatal("k1 should be on disk")
+	}
+	gee.Remove("k1")
+	if gee.diskStore.Contains("k1") {
+		t.Fatal("Remove should drop the disk copy")
+	}
+	if err := gee.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//重启后仍能读到磁盘中的条目
+	loads = 0
+	restarted := NewGroup("disktier-restart", 64, getter, WithDiskTier(dir, 1<<20))
+	defer restarted.Close()
+	if view, err := restarted.Get("k2"); err != nil || view.String() != "value-k2" || loads != 0 {
+		t.Fatalf("k2 should survive a restart, got %s, %v", view, err)
+	}
+	if _, err := restarted.Get("k1"); err != nil || loads != 1 {
+		t.Fatal("removed k1 should not come back after a restart")
+	}
+}
@@ -0,0 +1,73 @@
+package tinylfu
+
+import "hash/fnv"
+
+const (
+	sketchDepth = 4  //哈希函数个数
+	maxCount    = 15 //计数器上限(4bit)
+	resetFactor = 10 //累计增加 width*resetFactor 次后计数减半
+)
+
+// Count-Min Sketch，用很小的内存近似统计每个key的访问频率
+// 定期将所有计数减半，使频率能反映最近的访问情况
+type sketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+// width会向上取整为2的幂
+func newSketch(width int) *sketch {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{mask: uint64(w - 1), resetAt: w * resetFactor}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+func (s *sketch) increment(key string) {
+	h1, h2 := hashKey(key)
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][idx] < maxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+// 取所有行中的最小值作为估计值
+func (s *sketch) estimate(key string) uint8 {
+	h1, h2 := hashKey(key)
+	min := uint8(maxCount)
+	for i := range s.rows {
+		if c := s.rows[i][(h1+uint64(i)*h2)&s.mask]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+func hashKey(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum, sum>>32 | 1
+}
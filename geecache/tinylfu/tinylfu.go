@@ -0,0 +1,214 @@
+package tinylfu
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value 与lru.Value相同，便于各淘汰策略互换
+type Value = lru.Value
+
+const (
+	windowRatio    = 0.01 //窗口占总容量的比例
+	avgEntryBytes  = 64   //估算条目数时假设的平均大小
+	minSketchWidth = 1 << 10
+	maxSketchWidth = 1 << 20
+)
+
+// 带TinyLFU准入策略的LRU(W-TinyLFU)
+// 新条目先进入一个很小的LRU窗口，被挤出窗口后要进入主LRU，
+// 需要和主LRU中将被淘汰的条目比较访问频率，频率更高才会被接纳，
+// 从而避免一次性的扫描把热点数据冲刷掉
+type Cache struct {
+	maxBytes    int64
+	windowLimit int64
+	window      *list.List
+	main        *list.List
+	windowBytes int64
+	mainBytes   int64
+	items       map[string]*list.Element
+	sketch      *sketch
+	OnEvicted   func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time
+	inMain bool //是否位于主LRU
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+// new a instance
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	width := int(maxBytes / avgEntryBytes)
+	if width < minSketchWidth {
+		width = minSketchWidth
+	}
+	if width > maxSketchWidth {
+		width = maxSketchWidth
+	}
+	return &Cache{
+		maxBytes:    maxBytes,
+		windowLimit: int64(float64(maxBytes) * windowRatio),
+		window:      list.New(),
+		main:        list.New(),
+		items:       make(map[string]*list.Element),
+		sketch:      newSketch(width),
+		OnEvicted:   onEvicted,
+	}
+}
+
+// 无论是否命中都会记录一次访问
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	c.sketch.increment(key)
+	ele, ok := c.items[key]
+	if !ok {
+		return
+	}
+	kv := ele.Value.(*entry)
+	if kv.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.listOf(kv).MoveToFront(ele)
+	return kv.value, true
+}
+
+// add or modify
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.items[key]; ok {
+		kv := ele.Value.(*entry)
+		c.addBytes(kv, int64(value.Len())-int64(kv.value.Len()))
+		kv.value = value
+		kv.expire = expire
+		c.listOf(kv).MoveToFront(ele)
+	} else {
+		kv := &entry{key: key, value: value, expire: expire}
+		c.items[key] = c.window.PushFront(kv)
+		c.windowBytes += kv.size()
+	}
+	c.admit()
+	for c.maxBytes != 0 && c.windowBytes+c.mainBytes > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// 优先淘汰主LRU中最久未使用的条目
+func (c *Cache) RemoveOldest() {
+	if ele := c.main.Back(); ele != nil {
+		c.removeElement(ele)
+	} else if ele := c.window.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.items[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+func (c *Cache) RemoveExpired() {
+	now := time.Now()
+	for _, ele := range c.items {
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.items)
+}
+
+// 当前已使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.windowBytes + c.mainBytes
+}
+
+// 依次遍历主LRU、窗口中的条目(各自从旧到新)，f返回false时停止
+func (c *Cache) Range(f func(key string, value Value, expire time.Time) bool) {
+	if rangeList(c.main, f) {
+		rangeList(c.window, f)
+	}
+}
+
+func rangeList(l *list.List, f func(key string, value Value, expire time.Time) bool) bool {
+	for ele := l.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !f(kv.key, kv.value, kv.expire) {
+			return false
+		}
+	}
+	return true
+}
+
+// 窗口超出大小时，把窗口中最旧的条目作为候选者尝试放入主LRU
+// 最新的条目始终保留在窗口中
+func (c *Cache) admit() {
+	for c.windowBytes > c.windowLimit && c.window.Len() > 1 {
+		ele := c.window.Back()
+		kv := ele.Value.(*entry)
+		c.window.Remove(ele)
+		c.windowBytes -= kv.size()
+
+		//主LRU还有空间，直接接纳
+		if c.maxBytes == 0 || c.windowBytes+c.mainBytes+kv.size() <= c.maxBytes {
+			c.pushMain(kv)
+			continue
+		}
+		//与主LRU中的淘汰者比较访问频率
+		victim := c.main.Back()
+		if victim == nil || c.sketch.estimate(kv.key) <= c.sketch.estimate(victim.Value.(*entry).key) {
+			delete(c.items, kv.key)
+			if c.OnEvicted != nil {
+				c.OnEvicted(kv.key, kv.value)
+			}
+			continue
+		}
+		for c.main.Len() > 0 && c.windowBytes+c.mainBytes+kv.size() > c.maxBytes {
+			c.removeElement(c.main.Back())
+		}
+		c.pushMain(kv)
+	}
+}
+
+func (c *Cache) pushMain(kv *entry) {
+	kv.inMain = true
+	c.items[kv.key] = c.main.PushFront(kv)
+	c.mainBytes += kv.size()
+}
+
+func (c *Cache) listOf(kv *entry) *list.List {
+	if kv.inMain {
+		return c.main
+	}
+	return c.window
+}
+
+func (c *Cache) addBytes(kv *entry, delta int64) {
+	if kv.inMain {
+		c.mainBytes += delta
+	} else {
+		c.windowBytes += delta
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.listOf(kv).Remove(ele)
+	c.addBytes(kv, -kv.size())
+	delete(c.items, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
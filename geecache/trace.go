@@ -0,0 +1,169 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	pb "geecache/geecachepb"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// span的名字
+const (
+	SpanCacheHit    = "cache_hit"    //命中本机的mainCache或hotCache
+	SpanPeerFetch   = "peer_fetch"   //从其他节点获取
+	SpanBackendLoad = "backend_load" //通过Getter从数据源获取
+)
+
+// 节点间传递请求元数据的HTTP头
+const (
+	headerTraceID  = "X-Geecache-Trace-Id"
+	headerSpanID   = "X-Geecache-Span-Id"
+	headerCaller   = "X-Geecache-Caller"
+	headerDeadline = "X-Geecache-Deadline"
+)
+
+// Span 一次缓存操作的记录，结束时交给SpanHook
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string //父span，为空表示这是调用链的第一个span
+	Name     string
+	Group    string
+	Key      string
+	Caller   string //请求来自其他节点时为对方的地址
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// SpanHook 接收Group产生的span，可以转换后发送给链路追踪系统
+// 在请求的goroutine中同步调用，不应阻塞
+type SpanHook interface {
+	OnSpan(s Span)
+}
+
+// 接口型函数，同GetterFunc
+type SpanHookFunc func(s Span)
+
+func (f SpanHookFunc) OnSpan(s Span) {
+	f(s)
+}
+
+type traceKey struct{}
+
+// 保存在context中的调用链信息
+type traceInfo struct {
+	traceID string
+	spanID  string
+	caller  string
+}
+
+// 将调用方已有的trace与span ID放入ctx，之后的span都属于这条调用链
+func WithTrace(ctx context.Context, traceID, spanID string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceInfo{traceID: traceID, spanID: spanID})
+}
+
+// 返回ctx中当前的trace与span ID，没有时为空
+func TraceFromContext(ctx context.Context) (traceID, spanID string) {
+	t, _ := ctx.Value(traceKey{}).(traceInfo)
+	return t.traceID, t.spanID
+}
+
+func newTraceID() string {
+	return fmt.Sprintf("%016x%016x", rand.Uint64(), rand.Uint64())
+}
+
+func newSpanID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+// 开始一个span，返回的ctx以它为父span
+// 没有设置SpanHook时也会生成ID，保证调用链能传给其他节点
+func (g *Group) startSpan(ctx context.Context, name, key string) (context.Context, *Span) {
+	parent, _ := ctx.Value(traceKey{}).(traceInfo)
+	s := &Span{
+		TraceID:  parent.traceID,
+		SpanID:   newSpanID(),
+		ParentID: parent.spanID,
+		Name:     name,
+		Group:    g.name,
+		Key:      key,
+		Caller:   parent.caller,
+		Start:    time.Now(),
+	}
+	if s.TraceID == "" {
+		s.TraceID = newTraceID()
+	}
+	ctx = context.WithValue(ctx, traceKey{}, traceInfo{traceID: s.TraceID, spanID: s.SpanID, caller: parent.caller})
+	return ctx, s
+}
+
+// 结束span并交给SpanHook
+func (g *Group) endSpan(s *Span, err error) {
+	if g.spanHook == nil {
+		return
+	}
+	s.Duration = time.Since(s.Start)
+	s.Err = err
+	g.spanHook.OnSpan(*s)
+}
+
+// 请求中的元数据，pb.Request与pb.MultiRequest都实现了该接口
+type traceFields interface {
+	GetTraceId() string
+	GetSpanId() string
+	GetCaller() string
+	GetDeadline() int64
+}
+
+// 返回ctx中的调用链与截止时间，没有截止时间时deadline为0
+func traceMeta(ctx context.Context) (traceID, spanID string, deadline int64) {
+	t, _ := ctx.Value(traceKey{}).(traceInfo)
+	if d, ok := ctx.Deadline(); ok {
+		deadline = d.UnixNano()
+	}
+	return t.traceID, t.spanID, deadline
+}
+
+// 将ctx中的调用链与截止时间写入请求
+func traceRequest(ctx context.Context, req *pb.Request) {
+	req.TraceId, req.SpanId, req.Deadline = traceMeta(ctx)
+}
+
+// 同traceRequest，用于批量请求
+func traceMultiRequest(ctx context.Context, req *pb.MultiRequest) {
+	req.TraceId, req.SpanId, req.Deadline = traceMeta(ctx)
+}
+
+// 请求方把元数据放入HTTP头
+func setTraceHeader(h http.Header, in traceFields) {
+	if in.GetTraceId() != "" {
+		h.Set(headerTraceID, in.GetTraceId())
+		h.Set(headerSpanID, in.GetSpanId())
+	}
+	if in.GetCaller() != "" {
+		h.Set(headerCaller, in.GetCaller())
+	}
+	if in.GetDeadline() != 0 {
+		h.Set(headerDeadline, strconv.FormatInt(in.GetDeadline(), 10))
+	}
+}
+
+// 服务端从HTTP头恢复调用链与截止时间，返回的cancel需要调用
+func traceContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := r.Context()
+	if id := r.Header.Get(headerTraceID); id != "" {
+		ctx = context.WithValue(ctx, traceKey{}, traceInfo{
+			traceID: id,
+			spanID:  r.Header.Get(headerSpanID),
+			caller:  r.Header.Get(headerCaller),
+		})
+	}
+	if n, err := strconv.ParseInt(r.Header.Get(headerDeadline), 10, 64); err == nil && n > 0 {
+		return context.WithDeadline(ctx, time.Unix(0, n))
+	}
+	return context.WithCancel(ctx)
+}
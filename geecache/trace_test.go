@@ -0,0 +1,125 @@
+package geecache
+
+import (
+	"context"
+	pb "geecache/geecachepb"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 收集span的hook
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+func (r *spanRecorder) OnSpan(s Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) last() Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.spans[len(r.spans)-1]
+}
+
+func TestTracePropagation(t *testing.T) {
+	owner := &fakePeer{sets: map[string][]byte{"remote1": []byte("v")}}
+	rec := &spanRecorder{}
+	gee := NewGroup("trace", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }), WithSpanHook(rec))
+	gee.RegisterPeers(&fakePicker{owner: owner, all: []PeerGetter{owner}})
+
+	ctx, cancel := context.WithTimeout(WithTrace(context.Background(), "trace1", "parent"), time.Minute)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "remote1"); err != nil {
+		t.Fatal(err)
+	}
+	span := rec.last()
+	if span.Name != SpanPeerFetch || span.TraceID != "trace1" || span.ParentID != "parent" {
+		t.Fatalf("unexpected peer span %+v", span)
+	}
+	req := owner.lastReq
+	if req.TraceId != "trace1" || req.SpanId != span.SpanID || req.Deadline == 0 {
+		t.Fatalf("trace should be sent to the peer, got %v", req)
+	}
+
+	//批量获取：命中与节点获取都有span
+	gee.Get("cached")
+	if _, err := gee.GetMultiContext(ctx, []string{"cached", "remote2"}); err == nil {
+		t.Fatal("remote2 should fail")
+	}
+	rec.mu.Lock()
+	hit, fetch := rec.spans[len(rec.spans)-2], rec.spans[len(rec.spans)-1]
+	rec.mu.Unlock()
+	if hit.Name != SpanCacheHit || hit.Key != "cached" || fetch.Name != SpanPeerFetch || fetch.Key != "remote2" ||
+		fetch.TraceID != "trace1" || fetch.ParentID != "parent" {
+		t.Fatalf("unexpected GetMulti spans %+v, %+v", hit, fetch)
+	}
+
+	if _, err := gee.GetContext(ctx, "local"); err != nil {
+		t.Fatal(err)
+	}
+	if span = rec.last(); span.Name != SpanBackendLoad || span.TraceID != "trace1" {
+		t.Fatalf("unexpected backend span %+v", span)
+	}
+	gee.GetContext(context.Background(), "local")
+	if span = rec.last(); span.Name != SpanCacheHit || span.TraceID == "" || span.ParentID != "" {
+		t.Fatalf("hit without a trace should start a new one, got %+v", span)
+	}
+}
+
+func TestHTTPTracePropagation(t *testing.T) {
+	rec := &spanRecorder{}
+	var deadline bool
+	NewGroup("httptrace", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			_, deadline = ctx.Deadline()
+			return []byte(key), nil
+		}), WithSpanHook(rec))
+	p := NewHTTPPool("http://localhost:8001")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	req := &pb.Request{
+		Group:    "httptrace",
+		Key:      "Tom",
+		TraceId:  "trace1",
+		SpanId:   "span1",
+		Deadline: time.Now().Add(time.Minute).UnixNano(),
+	}
+	if err := p.newGetter(srv.URL).Get(context.Background(), req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	span := rec.last()
+	if span.Name != SpanBackendLoad || span.TraceID != "trace1" || span.ParentID != "span1" || span.Caller != "http://localhost:8001" {
+		t.Fatalf("server span should continue the caller's trace, got %+v", span)
+	}
+	if !deadline {
+		t.Fatal("server load should run under a deadline")
+	}
+
+	//批量请求同样传递调用链与截止时间
+	deadline = false
+	multi := &pb.MultiRequest{
+		Group:    "httptrace",
+		Keys:     []string{"Jack"},
+		TraceId:  "trace2",
+		SpanId:   "span2",
+		Deadline: time.Now().Add(time.Minute).UnixNano(),
+	}
+	if err := p.newGetter(srv.URL).GetMulti(context.Background(), multi, &pb.MultiResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	span = rec.last()
+	if span.Name != SpanBackendLoad || span.TraceID != "trace2" || span.ParentID != "span2" || span.Caller != "http://localhost:8001" {
+		t.Fatalf("server span should continue the caller's trace for GetMulti, got %+v", span)
+	}
+	if !deadline {
+		t.Fatal("server load should run under a deadline for GetMulti")
+	}
+}
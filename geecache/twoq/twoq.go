@@ -0,0 +1,240 @@
+package twoq
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value 与lru.Value相同，便于各淘汰策略互换
+type Value = lru.Value
+
+const (
+	recentRatio = 0.25 //recent占总容量的比例
+	ghostRatio  = 0.5  //ghost占总容量的比例
+)
+
+// 2Q淘汰策略，按字节计算容量
+// recent: 只访问过一次的条目(FIFO)  frequent: 访问过多次的条目(LRU)
+// ghost: 从recent淘汰的key，再次出现时直接进入frequent
+// 一次性的扫描只会冲刷recent，不会影响frequent中的热点数据
+type Cache struct {
+	maxBytes      int64
+	recentTarget  int64
+	ghostTarget   int64
+	recent        *list.List
+	frequent      *list.List
+	ghost         *list.List
+	recentBytes   int64
+	frequentBytes int64
+	ghostBytes    int64
+	items         map[string]*list.Element
+	ghosts        map[string]*list.Element
+	OnEvicted     func(key string, value Value)
+}
+
+type entry struct {
+	key      string
+	value    Value
+	expire   time.Time
+	frequent bool //是否位于frequent
+}
+
+type ghost struct {
+	key  string
+	size int64
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+// new a instance
+func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
+	return &Cache{
+		maxBytes:     maxBytes,
+		recentTarget: int64(float64(maxBytes) * recentRatio),
+		ghostTarget:  int64(float64(maxBytes) * ghostRatio),
+		recent:       list.New(),
+		frequent:     list.New(),
+		ghost:        list.New(),
+		items:        make(map[string]*list.Element),
+		ghosts:       make(map[string]*list.Element),
+		OnEvicted:    onEvicted,
+	}
+}
+
+// 命中recent的条目会被提升到frequent
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.items[key]
+	if !ok {
+		return
+	}
+	kv := ele.Value.(*entry)
+	if kv.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	if kv.frequent {
+		c.frequent.MoveToFront(ele)
+	} else {
+		c.unlink(ele)
+		c.pushFrequent(kv)
+	}
+	return kv.value, true
+}
+
+// add or modify
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	kv := &entry{key: key, value: value, expire: expire}
+	//超过总容量的条目放不下，与LRU一样直接淘汰，不影响已有的条目
+	if c.maxBytes != 0 && kv.size() > c.maxBytes {
+		c.reject(kv)
+		return
+	}
+	//已存在，更新后放入frequent
+	if ele, ok := c.items[key]; ok {
+		c.unlink(ele)
+		delete(c.items, key)
+		c.makeRoom(kv.size(), false)
+		c.pushFrequent(kv)
+		return
+	}
+	//最近被淘汰过，说明不是一次性访问，直接放入frequent
+	if ele, ok := c.ghosts[key]; ok {
+		c.removeGhost(ele)
+		c.makeRoom(kv.size(), true)
+		c.pushFrequent(kv)
+		return
+	}
+	c.makeRoom(kv.size(), false)
+	c.items[key] = c.recent.PushFront(kv)
+	c.recentBytes += kv.size()
+}
+
+// 淘汰一个条目
+func (c *Cache) RemoveOldest() {
+	if c.recent.Len()+c.frequent.Len() == 0 {
+		return
+	}
+	c.evict(false)
+}
+
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.items[key]; ok {
+		c.removeElement(ele)
+	}
+	if ele, ok := c.ghosts[key]; ok {
+		c.removeGhost(ele)
+	}
+}
+
+func (c *Cache) RemoveExpired() {
+	now := time.Now()
+	for _, ele := range c.items {
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.items)
+}
+
+// 当前已使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.recentBytes + c.frequentBytes
+}
+
+// 依次遍历recent、frequent中的条目(各自从旧到新)，f返回false时停止
+func (c *Cache) Range(f func(key string, value Value, expire time.Time) bool) {
+	if rangeList(c.recent, f) {
+		rangeList(c.frequent, f)
+	}
+}
+
+func rangeList(l *list.List, f func(key string, value Value, expire time.Time) bool) bool {
+	for ele := l.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !f(kv.key, kv.value, kv.expire) {
+			return false
+		}
+	}
+	return true
+}
+
+// 为size字节的新条目腾出空间
+func (c *Cache) makeRoom(size int64, ghostHit bool) {
+	for c.maxBytes != 0 && c.recent.Len()+c.frequent.Len() > 0 && c.recentBytes+c.frequentBytes+size > c.maxBytes {
+		c.evict(ghostHit)
+	}
+}
+
+// recent超过目标大小时淘汰recent并记入ghost，否则淘汰frequent
+func (c *Cache) evict(ghostHit bool) {
+	if c.recent.Len() > 0 && (c.recentBytes > c.recentTarget || (c.recentBytes == c.recentTarget && !ghostHit) || c.frequent.Len() == 0) {
+		kv := c.recent.Back().Value.(*entry)
+		c.removeElement(c.recent.Back())
+		g := &ghost{key: kv.key, size: kv.size()}
+		c.ghosts[g.key] = c.ghost.PushFront(g)
+		c.ghostBytes += g.size
+		for c.ghostBytes > c.ghostTarget && c.ghost.Len() > 0 {
+			c.removeGhost(c.ghost.Back())
+		}
+		return
+	}
+	c.removeElement(c.frequent.Back())
+}
+
+// 丢弃放不下的条目，key原有的值与幽灵条目一并删除
+func (c *Cache) reject(kv *entry) {
+	if ele, ok := c.items[kv.key]; ok {
+		c.unlink(ele)
+		delete(c.items, kv.key)
+	}
+	if ele, ok := c.ghosts[kv.key]; ok {
+		c.removeGhost(ele)
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) pushFrequent(kv *entry) {
+	kv.frequent = true
+	c.items[kv.key] = c.frequent.PushFront(kv)
+	c.frequentBytes += kv.size()
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.unlink(ele)
+	delete(c.items, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// 从recent或frequent中摘除，不触发回调
+func (c *Cache) unlink(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.frequent {
+		c.frequent.Remove(ele)
+		c.frequentBytes -= kv.size()
+	} else {
+		c.recent.Remove(ele)
+		c.recentBytes -= kv.size()
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	g := ele.Value.(*ghost)
+	c.ghost.Remove(ele)
+	c.ghostBytes -= g.size
+	delete(c.ghosts, g.key)
+}